@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jatgam/goutils/log"
+
+	"github.com/shawnsilva/piccolo/piccolo"
+	"github.com/shawnsilva/piccolo/youtube"
+)
+
+const bytesPerMB = 1024 * 1024
+
+func cacheUsage() {
+	fmt.Fprintf(os.Stderr, "\nUsage of %s cache:\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "  list     List every song in the cache")
+	fmt.Fprintln(os.Stderr, "  verify   Remove corrupt songs and stale partial downloads from the cache")
+	fmt.Fprintln(os.Stderr, "  prune    Remove least recently used songs, see prune -h")
+	fmt.Fprintln(os.Stderr, "  warm     Download every song in a playlist, see warm -h")
+}
+
+// runCacheCommand works with the song cache without connecting to discord.
+// Returns the exit code.
+func runCacheCommand(args []string) int {
+	if len(args) == 0 {
+		cacheUsage()
+		return 2
+	}
+	yt, err := piccolo.NewYoutubeManager(conf)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Invalid youtube config")
+		return 1
+	}
+	switch args[0] {
+	case "list":
+		return cacheList(yt)
+	case "verify":
+		return cacheVerify(yt)
+	case "prune":
+		return cachePrune(yt, args[1:])
+	case "warm":
+		return cacheWarm(yt, args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "Unknown cache command: %s\n", args[0])
+	cacheUsage()
+	return 2
+}
+
+func cacheList(yt *youtube.Manager) int {
+	songs, err := yt.CachedSongs()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cacheDir": filepath.FromSlash(yt.YTCacheDir),
+			"error":    err,
+		}).Error("Failed to list song cache")
+		return 1
+	}
+	var totalSize int64
+	for _, song := range songs {
+		fmt.Printf("%s\t%8.2f MB\t%s\n", song.VideoID, float64(song.Size)/bytesPerMB,
+			song.LastAccess.Format("2006-01-02 15:04"))
+		totalSize += song.Size
+	}
+	fmt.Printf("%d songs, %.2f MB\n", len(songs), float64(totalSize)/bytesPerMB)
+	return 0
+}
+
+func cacheVerify(yt *youtube.Manager) int {
+	removed, err := yt.VerifyCache()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cacheDir": filepath.FromSlash(yt.YTCacheDir),
+			"error":    err,
+		}).Error("Failed to verify song cache")
+		return 1
+	}
+	for _, videoID := range removed {
+		fmt.Printf("Removed corrupt song: %s\n", videoID)
+	}
+	fmt.Printf("%d corrupt songs removed\n", len(removed))
+	return 0
+}
+
+func cachePrune(yt *youtube.Manager, args []string) int {
+	flags := flag.NewFlagSet("cache prune", flag.ExitOnError)
+	maxSize := flags.Int("max-size", conf.Bot.CacheMaxSize, "Max size of the cache in MB, 0 for no limit.")
+	maxAge := flags.Int("max-age", conf.Bot.CacheMaxAge, "Remove songs not played in this many days, 0 for no limit.")
+	playlistPath := flags.String("playlist", conf.Bot.PlaylistPath, "Songs in this playlist are never removed, empty to protect nothing.")
+	flags.Parse(args)
+
+	protected := make(map[string]bool)
+	if *playlistPath != "" {
+		playlist, err := piccolo.ReadPlaylistFile(filepath.ToSlash(*playlistPath))
+		if err != nil {
+			return 1
+		}
+		for _, entry := range playlist.Entries {
+			if entry.VideoID != "" {
+				protected[entry.VideoID] = true
+			}
+		}
+	}
+	removed, err := yt.PruneCache(int64(*maxSize)*bytesPerMB, time.Duration(*maxAge)*24*time.Hour, protected)
+	for _, song := range removed {
+		fmt.Printf("Removed %s (%.2f MB)\n", song.VideoID, float64(song.Size)/bytesPerMB)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cacheDir": filepath.FromSlash(yt.YTCacheDir),
+			"error":    err,
+		}).Error("Failed to prune song cache")
+		return 1
+	}
+	fmt.Printf("%d songs removed\n", len(removed))
+	return 0
+}
+
+func cacheWarm(yt *youtube.Manager, args []string) int {
+	flags := flag.NewFlagSet("cache warm", flag.ExitOnError)
+	playlistPath := flags.String("playlist", conf.Bot.PlaylistPath, "Playlist to download songs from.")
+	workers := flags.Int("workers", conf.Bot.DownloadWorkers, "How many songs to download at once.")
+	flags.Parse(args)
+
+	playlist, err := piccolo.ReadPlaylistFile(filepath.ToSlash(*playlistPath))
+	if err != nil {
+		return 1
+	}
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	var wg sync.WaitGroup
+	var countLock sync.Mutex
+	failed := 0
+	downloaded := 0
+	cached := 0
+	workerSlots := make(chan struct{}, *workers)
+	for _, entry := range playlist.Entries {
+		if entry.Live || entry.VideoID == "" {
+			// Live streams are never cached
+			continue
+		}
+		if _, err := os.Stat(filepath.FromSlash(yt.DCAPath(entry.VideoID))); err == nil {
+			cached++
+			continue
+		}
+		wg.Add(1)
+		workerSlots <- struct{}{}
+		go func(entry piccolo.PlaylistEntry) {
+			defer wg.Done()
+			defer func() { <-workerSlots }()
+			fmt.Printf("Downloading %s: %s\n", entry.VideoID, entry.Title)
+			_, err := yt.DownloadDCAAudio(entry.VideoID)
+			countLock.Lock()
+			defer countLock.Unlock()
+			if err != nil {
+				fmt.Printf("Failed to download %s: %s\n", entry.VideoID, err)
+				failed++
+				return
+			}
+			downloaded++
+		}(entry)
+	}
+	wg.Wait()
+	fmt.Printf("%d songs downloaded, %d failed, %d already cached\n", downloaded, failed, cached)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
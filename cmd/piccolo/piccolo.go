@@ -27,8 +27,10 @@ var (
 )
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "\nUsage of %s:\n\n", (os.Args[0]))
+	fmt.Fprintf(os.Stderr, "\nUsage of %s [flags] [command]:\n\n", (os.Args[0]))
 	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nCommands:\n\n")
+	fmt.Fprintln(os.Stderr, "  cache    Work with the song cache without connecting to discord")
 	os.Exit(2)
 }
 
@@ -68,6 +70,16 @@ func init() {
 		}).Fatal("Error Loading Config.")
 	}
 
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "cache":
+			os.Exit(runCacheCommand(flag.Args()[1:]))
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", flag.Arg(0))
+			usage()
+		}
+	}
+
 	bot = piccolo.NewBot(conf, appVersion)
 }
 
@@ -1,15 +1,13 @@
 module github.com/shawnsilva/piccolo
 
-go 1.12
+go 1.13
 
 require (
 	github.com/PuerkitoBio/goquery v1.2.0 // indirect
 	github.com/andybalholm/cascadia v0.0.0-20161224141413-349dd0209470 // indirect
-	github.com/bwmarrin/discordgo v0.18.0
-	github.com/gorilla/websocket v1.2.0 // indirect
+	github.com/bwmarrin/discordgo v0.27.1
 	github.com/jatgam/goutils v0.1.0
 	github.com/jonas747/dca v0.0.0-20171004024810-01f9985f4a26
 	github.com/jonas747/ogg v0.0.0-20161220051205-b4f6f4cf3757 // indirect
 	github.com/rylio/ytdl v0.5.2-0.20190315183053-1f14ef2e151a
-	golang.org/x/net v0.0.0-20180112015858-5ccada7d0a7b // indirect
 )
@@ -0,0 +1,157 @@
+package piccolo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type argKind int
+
+const (
+	// argText is the rest of the command, it must be the last argument
+	argText argKind = iota
+	// argWord is a single word
+	argWord
+	// argNumber is a whole number greater than 0
+	argNumber
+	// argUser is a mention of a user
+	argUser
+)
+
+type (
+	// commandArg describes an argument a command takes.
+	commandArg struct {
+		name string
+		// description is shown for the option of the slash command
+		description string
+		kind        argKind
+		required    bool
+		// keywords are words accepted in place of the argument's kind, such as
+		// all for a number of days
+		keywords []string
+	}
+
+	// commandArgs are the parsed arguments of a command, keyed by name. Numbers
+	// are ints, text, keywords and user ids are strings.
+	commandArgs map[string]interface{}
+)
+
+// usage shows how the argument is typed, optional arguments are in brackets.
+func (a commandArg) usage() string {
+	name := a.name
+	if a.kind == argUser {
+		name = "@" + name
+	}
+	if a.kind == argText {
+		name = name + "..."
+	}
+	if a.required {
+		return "<" + name + ">"
+	}
+	return "[" + name + "]"
+}
+
+// parse checks a word from the command matches the argument.
+func (a commandArg) parse(word string) (interface{}, error) {
+	for _, keyword := range a.keywords {
+		if strings.EqualFold(word, keyword) {
+			return keyword, nil
+		}
+	}
+	switch a.kind {
+	case argNumber:
+		num, err := strconv.Atoi(word)
+		if err != nil || num < 1 {
+			return nil, a.invalid(word, "a number greater than 0")
+		}
+		return num, nil
+	case argUser:
+		userID := strings.TrimPrefix(strings.TrimPrefix(word, "<@"), "!")
+		if !strings.HasPrefix(word, "<@") || !strings.HasSuffix(userID, ">") {
+			return nil, a.invalid(word, "a mention of a user")
+		}
+		return strings.TrimSuffix(userID, ">"), nil
+	}
+	return word, nil
+}
+
+func (a commandArg) invalid(word string, expected string) error {
+	for _, keyword := range a.keywords {
+		expected = expected + " or `" + keyword + "`"
+	}
+	return fmt.Errorf("**%s** isn't a valid %s, it must be %s", word, a.name, expected)
+}
+
+// parseArgs matches the words after the command name to the arguments it
+// takes. Arguments other than text can be given in any order, each word is
+// matched to the first argument not yet given that accepts it. A text argument
+// takes the rest of the command, starting at the first word no other argument
+// accepts.
+func parseArgs(schema []commandArg, content string) (commandArgs, error) {
+	args := make(commandArgs)
+	words := strings.Fields(content)
+	if len(words) > 0 {
+		words = words[1:]
+	}
+	for i, word := range words {
+		var firstErr error
+		matched := false
+		var textArg *commandArg
+		for j := range schema {
+			arg := schema[j]
+			if _, given := args[arg.name]; given {
+				continue
+			}
+			if arg.kind == argText {
+				if textArg == nil {
+					textArg = &schema[j]
+				}
+				continue
+			}
+			value, err := arg.parse(word)
+			if err == nil {
+				args[arg.name] = value
+				matched = true
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if matched {
+			continue
+		}
+		if textArg != nil {
+			args[textArg.name] = strings.Join(words[i:], " ")
+			break
+		}
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, fmt.Errorf("Didn't expect **%s**", word)
+	}
+	for _, arg := range schema {
+		if _, ok := args[arg.name]; arg.required && !ok {
+			return nil, fmt.Errorf("Missing the %s", arg.name)
+		}
+	}
+	return args, nil
+}
+
+// number returns a number argument, or def if it wasn't given.
+func (a commandArgs) number(name string, def int) int {
+	if num, ok := a[name].(int); ok {
+		return num
+	}
+	return def
+}
+
+// text returns a text, keyword or user argument, or an empty string if it
+// wasn't given.
+func (a commandArgs) text(name string) string {
+	if text, ok := a[name].(string); ok {
+		return text
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package piccolo
+
+import (
+	"testing"
+)
+
+var historyArgs = []commandArg{{name: "count", kind: argNumber}, {name: "user", kind: argUser}}
+
+func TestParseArgsAnyOrder(t *testing.T) {
+	tests := []struct {
+		content string
+		count   int
+		user    string
+	}{
+		{"!history", 0, ""},
+		{"!history 5", 5, ""},
+		{"!history <@123>", 0, "123"},
+		{"!history 5 <@123>", 5, "123"},
+		{"!history <@!123> 5", 5, "123"},
+	}
+	for _, test := range tests {
+		args, err := parseArgs(historyArgs, test.content)
+		if err != nil {
+			t.Errorf("%s: %s", test.content, err)
+			continue
+		}
+		if got := args.number("count", 0); got != test.count {
+			t.Errorf("%s: count = %d, want %d", test.content, got, test.count)
+		}
+		if got := args.text("user"); got != test.user {
+			t.Errorf("%s: user = %q, want %q", test.content, got, test.user)
+		}
+	}
+}
+
+func TestParseArgsInvalid(t *testing.T) {
+	for _, content := range []string{"!history five", "!history 5 6", "!history <@1> <@2>", "!history 0"} {
+		if _, err := parseArgs(historyArgs, content); err == nil {
+			t.Errorf("%s was accepted", content)
+		}
+	}
+}
+
+func TestParseArgsText(t *testing.T) {
+	schema := []commandArg{{name: "song", kind: argText, required: true}}
+	args, err := parseArgs(schema, "!play 99  red balloons")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := args.text("song"); got != "99 red balloons" {
+		t.Errorf("song = %q", got)
+	}
+	if _, err := parseArgs(schema, "!play"); err == nil {
+		t.Error("Missing required text was accepted")
+	}
+}
+
+func TestParseArgsKeywords(t *testing.T) {
+	schema := []commandArg{{name: "days", kind: argNumber, keywords: []string{"all"}}}
+	args, err := parseArgs(schema, "!prune ALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := args.text("days"); got != "all" {
+		t.Errorf("days = %q, want all", got)
+	}
+}
@@ -1,10 +1,13 @@
 package piccolo
 
 import (
+	"fmt"
+	"net/http"
 	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -28,7 +31,13 @@ type (
 
 		lock *sync.Mutex
 
-		yt *youtube.Manager
+		yt        *youtube.Manager
+		downloads *downloadManager
+		cache     *cacheManager
+
+		favorites  *favorites
+		queueViews *queueViews
+		deletions  *deleteScheduler
 	}
 
 	guildControls struct {
@@ -42,13 +51,42 @@ type (
 // NewBot will create an instance of a bot
 func NewBot(c *utils.Config, v *version.Info) *Bot {
 	b := &Bot{
-		conf:    c,
-		version: v,
-		lock:    &sync.Mutex{},
+		conf:       c,
+		version:    v,
+		lock:       &sync.Mutex{},
+		queueViews: newQueueViews(),
 	}
 	return b
 }
 
+// NewYoutubeManager creates a youtube manager from the config, it doesn't need
+// a running bot so it can be used to work with the song cache offline. An
+// error is returned if the config names an extractor that doesn't exist.
+func NewYoutubeManager(c *utils.Config) (*youtube.Manager, error) {
+	yt := &youtube.Manager{
+		APIKey:        c.GoogleAPIKey,
+		YtDlPath:      c.Bot.YtDlPath,
+		YTCacheDir:    path.Join(filepath.ToSlash(c.Bot.CacheDir), "/", "ytdl"),
+		Extractors:    c.Bot.Extractors,
+		SearchBackend: c.Bot.SearchBackend,
+		InvidiousURL:  c.Bot.InvidiousURL,
+		SearchCache: youtube.NewSearchCache(path.Join(filepath.ToSlash(c.Bot.DataDir), "search_cache.json"),
+			time.Duration(c.Bot.SearchCacheTTL)*time.Hour),
+		Quota: youtube.NewQuotaTracker(path.Join(filepath.ToSlash(c.Bot.DataDir), "quota.json"),
+			c.Bot.APIDailyQuota, c.Bot.QuotaWarnPercent),
+		HTTPClient:      &http.Client{Timeout: time.Duration(c.Bot.APITimeout) * time.Second},
+		APIBaseURL:      c.Bot.APIBaseURL,
+		SafeSearch:      c.Bot.SearchSafeSearch,
+		RegionCode:      c.Bot.SearchRegion,
+		VideoCategoryID: c.Bot.SearchCategory,
+		RankKeywords:    c.Bot.SearchRankKeywords,
+	}
+	if err := yt.ValidateExtractors(); err != nil {
+		return nil, err
+	}
+	return yt, nil
+}
+
 // Start will start the bot
 func (b *Bot) Start() {
 	b.lock.Lock()
@@ -59,22 +97,52 @@ func (b *Bot) Start() {
 		return
 	}
 
-	b.yt = &youtube.Manager{
-		APIKey:     b.conf.GoogleAPIKey,
-		YtDlPath:   b.conf.Bot.YtDlPath,
-		YTCacheDir: path.Join(filepath.ToSlash(b.conf.Bot.CacheDir), "/", "ytdl"),
+	b.deletions = newDeleteScheduler(b.dg)
+	b.yt, err = NewYoutubeManager(b.conf)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Invalid youtube config")
+		return
 	}
+	b.yt.Quota.OnWarning = b.warnQuota
+
+	if b.conf.Bot.VerifyCacheOnStart {
+		removed, err := b.yt.VerifyCache()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("Failed to verify song cache")
+		} else if len(removed) > 0 {
+			log.WithFields(log.Fields{
+				"songs": removed,
+			}).Info("Removed corrupt songs from cache, they will be downloaded again")
+		}
+	}
+
+	b.favorites = newFavorites(path.Join(filepath.ToSlash(b.conf.Bot.DataDir), "favorites.json"))
 
 	b.dg.AddHandler(b.ready)
 	b.dg.AddHandler(b.messageCreate)
+	b.dg.AddHandler(b.messageReactionAdd)
 	b.dg.AddHandler(b.voiceStateChange)
+	b.dg.AddHandler(b.interactionCreate)
+	// Prefix commands need to read the content of messages, this is a
+	// privileged intent that must be enabled in the developer portal
+	b.dg.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentMessageContent
 
 	err = b.dg.Open()
 	if err != nil {
 		return
 	}
 
-	downloadLock := &sync.Mutex{}
+	b.cache = newCacheManager(b.yt, b.conf.Bot.SaveVideos, int64(b.conf.Bot.CacheMaxSize)*1024*1024,
+		time.Duration(b.conf.Bot.CacheMaxAge)*24*time.Hour, b.protectedSongs)
+	b.downloads = newDownloadManager(b.yt, b.conf.Bot.DownloadWorkers, b.conf.Bot.DownloadRetries,
+		time.Duration(b.conf.Bot.DownloadRetryDelay)*time.Second)
+	b.guildLookup = make(map[string]*guildControls)
+	b.textChannelLookup = make(map[string]*guildControls)
+	b.voiceChannelLookup = make(map[string]*guildControls)
 	for _, guild := range b.conf.Guilds {
 		vch, err := b.dg.Channel(guild.AutoJoinVoiceChannel)
 		if err != nil {
@@ -134,11 +202,8 @@ func (b *Bot) Start() {
 			guildID:        gID,
 			voiceChannelID: guild.AutoJoinVoiceChannel,
 			textChannelIDs: textChIDs,
-			player:         newPlayer(b.conf, gID, guild.AutoJoinVoiceChannel, b.yt, downloadLock, b.dg),
+			player:         newPlayer(b.conf, gID, guild.AutoJoinVoiceChannel, b.yt, b.downloads, b.cache, b.deletions, b.dg),
 		}
-		b.guildLookup = make(map[string]*guildControls)
-		b.textChannelLookup = make(map[string]*guildControls)
-		b.voiceChannelLookup = make(map[string]*guildControls)
 		b.guildLookup[gID] = gControl
 		if len(textChIDs) >= 1 {
 			for _, tChID := range textChIDs {
@@ -153,24 +218,102 @@ func (b *Bot) Start() {
 			}
 			gControl.textChannelIDs = textChIDs
 		}
+		gControl.player.boundChannelIDs = guild.BindToTextChannels
+		if len(guild.BindToTextChannels) > 0 {
+			// Only channels the bot is bound to get a persistent now playing
+			// message up front, rather than every channel in the guild
+			gControl.player.seedNowPlaying(guild.BindToTextChannels)
+		}
 		b.voiceChannelLookup[guild.AutoJoinVoiceChannel] = gControl
 	}
+	go b.cache.evict()
+	go b.fillPlaylistDetails()
+}
+
+// fillPlaylistDetails looks up the details of playlist songs that don't have
+// them yet, saving them to the playlist file so they're only looked up once.
+// Every guild plays the same playlist file, so the songs are looked up once
+// and given to each guild's copy.
+func (b *Bot) fillPlaylistDetails() {
+	if !b.conf.Bot.UsePlaylist {
+		return
+	}
+	var playlists []*playlist
+	for _, gControl := range b.guildLookup {
+		playlists = append(playlists, gControl.player.playlist)
+	}
+	if len(playlists) == 0 {
+		return
+	}
+	missing := playlists[0].missingDetails()
+	if len(missing) == 0 {
+		return
+	}
+	details, err := b.yt.VideoDetails(missing)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Failed to look up playlist song details")
+	}
+	for _, list := range playlists[1:] {
+		list.setDetails(details)
+	}
+	if playlists[0].setDetails(details) > 0 {
+		playlists[0].savePlaylist()
+	}
+}
+
+// warnQuota lets the bot owner know the youtube api quota is running low.
+func (b *Bot) warnQuota(used int, limit int) {
+	if b.conf.OwnerID == "" {
+		return
+	}
+	channel, err := b.dg.UserChannelCreate(b.conf.OwnerID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"owner": b.conf.OwnerID,
+			"error": err,
+		}).Error("Failed to open a direct message with the owner")
+		return
+	}
+	message := fmt.Sprintf("YouTube API quota is running low, %d of %d units used today. "+
+		"Searches will fall back to another backend when it runs out.", used, limit)
+	_, err = b.dg.ChannelMessageSend(channel.ID, message)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"owner": b.conf.OwnerID,
+			"error": err,
+		}).Error("Failed to send quota warning to the owner")
+	}
+}
+
+// protectedSongs finds every song that is playing, queued or in the playlist
+// of any guild, these songs must stay in the cache.
+func (b *Bot) protectedSongs() map[string]bool {
+	protected := make(map[string]bool)
+	for _, gControl := range b.guildLookup {
+		for _, videoID := range gControl.player.songIDs() {
+			protected[videoID] = true
+		}
+	}
+	return protected
 }
 
 // Stop will stop the bot
 func (b *Bot) Stop() {
-	_ = b.dg.UpdateStatus(0, "")
+	_ = b.dg.UpdateGameStatus(0, "")
 	for _, voiceCh := range b.voiceChannelLookup {
 		err := voiceCh.player.Shutdown()
 		if err != nil {
 			log.Error(err)
 		}
 	}
+	b.deletions.stop()
 	b.dg.Close()
 }
 
 func (b *Bot) ready(s *discordgo.Session, event *discordgo.Ready) {
-	_ = s.UpdateStatus(0, "Loading...")
+	_ = s.UpdateGameStatus(0, "Loading...")
 	b.lock.Lock()
 	defer b.lock.Unlock()
 	for _, vChannel := range b.voiceChannelLookup {
@@ -179,6 +322,9 @@ func (b *Bot) ready(s *discordgo.Session, event *discordgo.Ready) {
 			log.Error(err)
 		}
 	}
+	if b.conf.Bot.SlashCommands {
+		b.registerSlashCommands(event.User.ID)
+	}
 }
 
 func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -192,12 +338,33 @@ func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 				}).Error("Failed to find command")
 				return
 			}
-			cmdFunc := *foundCommand
-			cmdFunc(b, m)
+			b.runCommand(foundCommand, newMessageContext(m))
+			if b.conf.Bot.DeleteInvokingMessages {
+				b.deletions.schedule(m.ChannelID, m.ID, 0)
+			}
 		}
 	}
 }
 
+func (b *Bot) messageReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	gControl, ok := b.textChannelLookup[r.ChannelID]
+	if !ok || r.UserID == s.State.User.ID {
+		return
+	}
+	if b.queueReaction(s, r) {
+		return
+	}
+	if !gControl.player.isNowPlayingMessage(r.MessageID) {
+		return
+	}
+	switch r.Emoji.Name {
+	case likeEmoji:
+		gControl.player.rateCurrentSong(r.UserID, voteLike)
+	case dislikeEmoji:
+		gControl.player.rateCurrentSong(r.UserID, voteDislike)
+	}
+}
+
 func (b *Bot) voiceStateChange(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
 	guild, err := b.dg.State.Guild(v.GuildID)
 	if err != nil {
@@ -231,12 +398,23 @@ func (b *Bot) voiceStateChange(s *discordgo.Session, v *discordgo.VoiceStateUpda
 	}
 }
 
-func (b *Bot) reply(message string, m *discordgo.MessageCreate) {
-	msg, err := b.dg.ChannelMessageSend(m.ChannelID, message)
+func (b *Bot) reply(message string, m *commandContext) {
+	msg, err := m.sender(b.dg)(&discordgo.MessageSend{Content: message})
 	if err != nil {
 		log.WithFields(log.Fields{
 			"msg":   msg,
 			"error": err,
 		}).Error("Failed to send message")
+		return
+	}
+	b.autoDelete(msg)
+}
+
+// autoDelete schedules a message the bot sent to be deleted after the
+// configured delay, if the bot deletes its messages.
+func (b *Bot) autoDelete(msg *discordgo.Message) {
+	if !b.conf.Bot.DeleteMessages || msg == nil {
+		return
 	}
+	b.deletions.schedule(msg.ChannelID, msg.ID, time.Duration(b.conf.Bot.DeleteMessagesDelay)*time.Second)
 }
@@ -0,0 +1,92 @@
+package piccolo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jatgam/goutils/log"
+
+	"github.com/shawnsilva/piccolo/youtube"
+)
+
+// cacheManager is shared by every guild, and keeps the song cache from growing
+// forever.
+type cacheManager struct {
+	yt         *youtube.Manager
+	saveVideos bool
+	maxSize    int64
+	maxAge     time.Duration
+	protected  func() map[string]bool
+	lock       *sync.Mutex
+}
+
+// newCacheManager creates a cache manager. A maxSize or maxAge of 0 disables
+// that limit. protected is called to find songs that must never be removed.
+func newCacheManager(yt *youtube.Manager, saveVideos bool, maxSize int64, maxAge time.Duration, protected func() map[string]bool) *cacheManager {
+	return &cacheManager{
+		yt:         yt,
+		saveVideos: saveVideos,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		protected:  protected,
+		lock:       &sync.Mutex{},
+	}
+}
+
+// touch marks a song as just used.
+func (c *cacheManager) touch(videoID string) {
+	err := c.yt.TouchCachedSong(videoID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"song":  videoID,
+			"error": err,
+		}).Warn("Failed to update song access time")
+	}
+}
+
+// songFinished should be called after a song is done playing. If videos aren't
+// being saved the song is removed right away, unless it is protected.
+func (c *cacheManager) songFinished(videoID string) {
+	if c.saveVideos {
+		c.touch(videoID)
+		c.evict()
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.protected()[videoID] {
+		return
+	}
+	err := c.yt.RemoveCachedSong(videoID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"song":  videoID,
+			"error": err,
+		}).Error("Failed to remove song from cache")
+		return
+	}
+	log.WithFields(log.Fields{
+		"song": videoID,
+	}).Debug("Removed played song from cache")
+}
+
+// evict removes songs older than the max age, then the least recently used
+// songs until the cache is under the max size.
+func (c *cacheManager) evict() {
+	if c.maxSize <= 0 && c.maxAge <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	removed, err := c.yt.PruneCache(c.maxSize, c.maxAge, c.protected())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Failed to prune song cache")
+	}
+	for _, song := range removed {
+		log.WithFields(log.Fields{
+			"song": song.VideoID,
+		}).Debug("Evicted song from cache")
+	}
+}
@@ -2,137 +2,652 @@ package piccolo
 
 import (
 	"fmt"
+	"net/url"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 
-	"github.com/jatgam/goutils"
 	"github.com/jatgam/goutils/log"
+
+	"github.com/shawnsilva/piccolo/youtube"
 )
 
 type (
-	command    func(b *Bot, m *discordgo.MessageCreate)
-	commandMap map[string]command
+	command func(b *Bot, m *commandContext)
+
+	commandPermission int
+
+	// commandInfo describes a command, how it is typed and who can use it.
+	commandInfo struct {
+		name        string
+		aliases     []string
+		description string
+		args        []commandArg
+		permission  commandPermission
+		// cooldown is how long a user has to wait between uses
+		cooldown time.Duration
+		run      command
+	}
 
+	// commandHandler finds commands by their name or any alias, ignoring
+	// case.
 	commandHandler struct {
-		commands commandMap
+		commands []*commandInfo
+		lookup   map[string]*commandInfo
+		// cooldowns are when a user can next run a command with a cooldown,
+		// keyed by command name and user id
+		cooldowns map[string]time.Time
+		lock      *sync.Mutex
+	}
+
+	// commandContext is a command being run, from either a prefixed message or
+	// a slash command. Content is always the command as it would be typed,
+	// so commands don't need to care where they came from.
+	commandContext struct {
+		ChannelID string
+		GuildID   string
+		Content   string
+		Author    *discordgo.User
+		Mentions  []*discordgo.User
+
+		// args are parsed from Content before the command runs
+		args commandArgs
+
+		// interaction is set for slash commands, replies are sent through it
+		interaction *discordgo.Interaction
+		replied     bool
+		lock        *sync.Mutex
 	}
 )
 
+const (
+	// permAnyone lets anyone in a bound text channel use the command
+	permAnyone commandPermission = iota
+	// permListener requires the user to be in the voice channel
+	permListener
+)
+
+const (
+	defaultHistoryCount = 10
+	// maxHistoryCount keeps the history short enough to fit in one message
+	maxHistoryCount = 12
+	statsTopCount   = 5
+)
+
 var (
 	cmdHandler *commandHandler
 )
 
 func init() {
-	cmdHandler = &commandHandler{make(commandMap)}
-	cmdHandler.addCommand("help", help)
-	cmdHandler.addCommand("version", botVersion)
-	cmdHandler.addCommand("play", play)
-	cmdHandler.addCommand("skipSong", skipSong)
-	cmdHandler.addCommand("savePlaylist", savePlaylist)
-	cmdHandler.addCommand("showPlaylist", printPlaylist)
+	cmdHandler = newCommandHandler()
+	cmdHandler.addCommand(&commandInfo{
+		name:        "help",
+		description: "List the commands, or show how to use one of them.",
+		args:        []commandArg{{name: "command", description: "Command to show the usage of", kind: argWord}},
+		run:         help,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "version",
+		description: "Show the version of the bot.",
+		run:         botVersion,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "play",
+		description: "Search youtube for a song and add it to the queue. A live stream url, such as internet radio, is played as is, and favs queues your favorites.",
+		args:        []commandArg{{name: "song", description: "What to search for, a stream url or favs", kind: argText, required: true}},
+		cooldown:    3 * time.Second,
+		run:         play,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "skip",
+		aliases:     []string{"skipSong"},
+		description: "Vote to skip the current song.",
+		permission:  permListener,
+		run:         skipSong,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "savePlaylist",
+		aliases:     []string{"save"},
+		description: "Save the auto playlist to disk.",
+		run:         savePlaylist,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "queue",
+		aliases:     []string{"showPlaylist", "q"},
+		description: "Show the songs waiting to play.",
+		args:        []commandArg{{name: "page", description: "Page of the queue to show", kind: argNumber}},
+		run:         showQueue,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "history",
+		description: "Show recently played songs, optionally only those a user requested.",
+		args: []commandArg{
+			{name: "count", description: "How many songs to show", kind: argNumber},
+			{name: "user", description: "Only show songs this user requested", kind: argUser},
+		},
+		cooldown: 5 * time.Second,
+		run:      showHistory,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "stats",
+		description: "Show listening stats for a number of days, or all time.",
+		args:        []commandArg{{name: "days", description: "Number of days, or all", kind: argNumber, keywords: []string{"all"}}},
+		cooldown:    10 * time.Second,
+		run:         showStats,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "like",
+		description: "Like the current song.",
+		run:         likeSong,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "dislike",
+		description: "Dislike the current song.",
+		run:         dislikeSong,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "fav",
+		aliases:     []string{"favorite"},
+		description: "Add the current song to your favorites.",
+		run:         favoriteSong,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "np",
+		aliases:     []string{"nowPlaying"},
+		description: "Show the song that is playing.",
+		run:         nowPlaying,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "pause",
+		description: "Pause the current song until someone resumes it.",
+		permission:  permListener,
+		run:         pauseSong,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "resume",
+		aliases:     []string{"unpause"},
+		description: "Resume the paused song.",
+		permission:  permListener,
+		run:         resumeSong,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "loop",
+		aliases:     []string{"repeat"},
+		description: "Turn looping the current song on or off.",
+		permission:  permListener,
+		run:         loopSong,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "shuffle",
+		description: "Shuffle the queued songs.",
+		permission:  permListener,
+		run:         shuffleQueue,
+	})
+	cmdHandler.addCommand(&commandInfo{
+		name:        "stop",
+		description: "Clear the queue and stop the music, only if you are listening alone or are the bot owner.",
+		permission:  permListener,
+		run:         stopPlayer,
+	})
+}
+
+func newCommandHandler() *commandHandler {
+	return &commandHandler{
+		lookup:    make(map[string]*commandInfo),
+		cooldowns: make(map[string]time.Time),
+		lock:      &sync.Mutex{},
+	}
 }
 
-func (h commandHandler) addCommand(name string, c command) {
-	h.commands[name] = c
+func (h *commandHandler) addCommand(cmd *commandInfo) {
+	h.commands = append(h.commands, cmd)
+	h.lookup[strings.ToLower(cmd.name)] = cmd
+	for _, alias := range cmd.aliases {
+		h.lookup[strings.ToLower(alias)] = cmd
+	}
 }
 
-func (h commandHandler) getAllCommands() commandMap {
-	return h.commands
+// getAllCommands returns every command, sorted by name.
+func (h *commandHandler) getAllCommands() []*commandInfo {
+	commands := append([]*commandInfo{}, h.commands...)
+	sort.Slice(commands, func(i, j int) bool {
+		return strings.ToLower(commands[i].name) < strings.ToLower(commands[j].name)
+	})
+	return commands
 }
 
-func (h commandHandler) get(name string) (*command, bool) {
-	cmd, found := h.commands[name]
-	return &cmd, found
+func (h *commandHandler) get(name string) (*commandInfo, bool) {
+	cmd, found := h.lookup[strings.ToLower(name)]
+	return cmd, found
 }
 
-func help(b *Bot, m *discordgo.MessageCreate) {
-	var msg string
-	var cmdListStr string
-	var cmdList []string
-	for cmdN := range cmdHandler.getAllCommands() {
-		cmdList = append(cmdList, b.conf.CommandPrefix+cmdN)
+// cooldownLeft is how long until a user can run a command again. If they can
+// run it now, it is recorded as used.
+func (h *commandHandler) cooldownLeft(cmd *commandInfo, userID string) time.Duration {
+	if cmd.cooldown <= 0 {
+		return 0
 	}
-	sort.Strings(cmdList)
-	cmdListStr = fmt.Sprintf("```%s```", goutils.StrJoin(cmdList, " "))
-	msg = fmt.Sprintf("<@%s>, **Commands**\n%s\n%s", m.Author.ID, cmdListStr, "https://github.com/shawnsilva/piccolo/wiki/Commands")
-	b.reply(msg, m)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	key := cmd.name + ":" + userID
+	now := time.Now()
+	if left := h.cooldowns[key].Sub(now); left > 0 {
+		return left
+	}
+	// Each command has its own cooldown, so entries are dropped by when they
+	// expire rather than by the cooldown of this command
+	for cooldownKey, expires := range h.cooldowns {
+		if !now.Before(expires) {
+			delete(h.cooldowns, cooldownKey)
+		}
+	}
+	h.cooldowns[key] = now.Add(cmd.cooldown)
+	return 0
+}
+
+// usage shows how the command is typed.
+func (cmd *commandInfo) usage(prefix string) string {
+	usage := prefix + cmd.name
+	for _, arg := range cmd.args {
+		usage = usage + " " + arg.usage()
+	}
+	return usage
 }
 
-func botVersion(b *Bot, m *discordgo.MessageCreate) {
+// runCommand checks the user can run a command and parses its arguments,
+// before running it. Problems are reported the same way for every command.
+func (b *Bot) runCommand(cmd *commandInfo, m *commandContext) {
+	args, err := parseArgs(cmd.args, m.Content)
+	if err != nil {
+		b.sendMessage(errorMessage(m.Author.ID, fmt.Sprintf("%s. Usage: `%s`", err, cmd.usage(b.conf.CommandPrefix))), m)
+		return
+	}
+	if cmd.permission == permListener {
+		if gControl, ok := b.textChannelLookup[m.ChannelID]; ok {
+			_, listening, err := b.voiceListeners(gControl, m.Author.ID)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"guild": gControl.guildID,
+					"error": err,
+				}).Error("Failed to determine guild info")
+				return
+			}
+			if !listening {
+				b.sendMessage(errorMessage(m.Author.ID, fmt.Sprintf("You are not even listening, you don't get to use `%s%s`!",
+					b.conf.CommandPrefix, cmd.name)), m)
+				return
+			}
+		}
+	}
+	if left := cmdHandler.cooldownLeft(cmd, m.Author.ID); left > 0 {
+		b.sendMessage(errorMessage(m.Author.ID, fmt.Sprintf("Slow down, you can use `%s%s` again in %s.",
+			b.conf.CommandPrefix, cmd.name, left.Truncate(time.Second)+time.Second)), m)
+		return
+	}
+	m.args = args
+	cmd.run(b, m)
+}
+
+func newMessageContext(m *discordgo.MessageCreate) *commandContext {
+	return &commandContext{
+		ChannelID: m.ChannelID,
+		GuildID:   m.GuildID,
+		Content:   m.Content,
+		Author:    m.Author,
+		Mentions:  m.Mentions,
+		lock:      &sync.Mutex{},
+	}
+}
+
+// sender returns how replies to the command are sent. Slash commands are
+// answered by editing the deferred response the first time, and with follow
+// up messages after that.
+func (m *commandContext) sender(dg *discordgo.Session) messageSender {
+	if m.interaction == nil {
+		return channelSender(dg, m.ChannelID)
+	}
+	return func(data *discordgo.MessageSend) (*discordgo.Message, error) {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		if !m.replied {
+			msg, err := dg.InteractionResponseEdit(m.interaction, &discordgo.WebhookEdit{
+				Content: &data.Content,
+				Embeds:  &data.Embeds,
+			})
+			if err == nil {
+				m.replied = true
+			}
+			return msg, err
+		}
+		return dg.FollowupMessageCreate(m.interaction, true, &discordgo.WebhookParams{
+			Content: data.Content,
+			Embeds:  data.Embeds,
+		})
+	}
+}
+
+func help(b *Bot, m *commandContext) {
+	prefix := b.conf.CommandPrefix
+	if name := m.args.text("command"); name != "" {
+		cmd, found := cmdHandler.get(strings.TrimPrefix(name, prefix))
+		if !found {
+			b.sendMessage(errorMessage(m.Author.ID, fmt.Sprintf("There's no command named **%s**, use `%shelp` to list them.", name, prefix)), m)
+			return
+		}
+		b.sendMessage(commandHelpMessage(m.Author.ID, prefix, cmd), m)
+		return
+	}
+	var lines []string
+	for _, cmd := range cmdHandler.getAllCommands() {
+		lines = append(lines, fmt.Sprintf("`%s` - %s", cmd.usage(prefix), cmd.description))
+	}
+	list := strings.Join(lines, "\n")
+	footer := fmt.Sprintf("Use %shelp <command> for more on a command.", prefix)
+	b.sendMessage(botMessage{
+		kind:        messageInfo,
+		mentionID:   m.Author.ID,
+		title:       "Commands",
+		description: list + "\n\nhttps://github.com/shawnsilva/piccolo/wiki/Commands",
+		footer:      footer,
+		text:        fmt.Sprintf("<@%s>, **Commands**\n%s\n%s\n%s", m.Author.ID, list, footer, "https://github.com/shawnsilva/piccolo/wiki/Commands"),
+	}, m)
+}
+
+// commandHelpMessage describes how to use a command.
+func commandHelpMessage(userID string, prefix string, cmd *commandInfo) botMessage {
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Usage", Value: "`" + cmd.usage(prefix) + "`"},
+	}
+	text := fmt.Sprintf("<@%s>, **%s%s**: %s\nUsage: `%s`", userID, prefix, cmd.name, cmd.description, cmd.usage(prefix))
+	if len(cmd.aliases) > 0 {
+		aliases := prefix + strings.Join(cmd.aliases, ", "+prefix)
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Aliases", Value: aliases, Inline: true})
+		text = text + "\nAliases: " + aliases
+	}
+	if cmd.permission == permListener {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Who", Value: "Listeners in the voice channel", Inline: true})
+		text = text + "\nOnly listeners in the voice channel can use this."
+	}
+	if cmd.cooldown > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Cooldown", Value: cmd.cooldown.String(), Inline: true})
+		text = text + "\nCooldown: " + cmd.cooldown.String()
+	}
+	return botMessage{
+		kind:        messageInfo,
+		mentionID:   userID,
+		title:       prefix + cmd.name,
+		description: cmd.description,
+		fields:      fields,
+		text:        text,
+	}
+}
+
+func botVersion(b *Bot, m *commandContext) {
 	msg := fmt.Sprintf("<@%s>, `VERSION: %s`", m.Author.ID, b.version.GetVersionString())
 	b.reply(msg, m)
 }
 
-func play(b *Bot, m *discordgo.MessageCreate) {
+func play(b *Bot, m *commandContext) {
 	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
 		log.WithFields(log.Fields{
 			"channel": m.ChannelID,
 		}).Error("Failed to find controller from channel id")
 		return
 	}
-	splitString := strings.SplitN(m.Content, " ", 2)
-	if len(splitString) <= 1 {
-		log.WithFields(log.Fields{
-			"command": m.Content,
-		}).Warn("!play doesn't appear to contain a search string")
-		b.reply(fmt.Sprintf("<@%s> - Sorry, your command didn't appear to have a song to search for: **%s**", m.Author.ID, m.Content), m)
+	song := m.args.text("song")
+	if song == "favs" {
+		playFavorites(b, m)
+		return
+	}
+	if isExternalURL(song) {
+		live, err := b.yt.IsLiveStream(song)
+		if err != nil || !live {
+			log.WithFields(log.Fields{
+				"url":   song,
+				"error": err,
+			}).Debug("Link isn't a live stream")
+			b.sendMessage(errorMessage(m.Author.ID, fmt.Sprintf("Sorry, **%s** isn't a live stream, only internet radio streams and youtube songs can be played.", song)), m)
+			return
+		}
+		// Internet radio and other streams are played as is, without searching
+		entry := PlaylistEntry{Title: song, Live: true, StreamURL: song}
+		b.textChannelLookup[m.ChannelID].player.playlist.addEntry(m.Author, m.ChannelID, entry)
+		b.textChannelLookup[m.ChannelID].player.stats.recordRequest(m.Author, entry.id(), entry.Title)
+		b.textChannelLookup[m.ChannelID].player.songAdded()
+		entry.Requester = m.Author
+		b.sendMessage(enqueuedMessage(m.Author.ID, &entry,
+			fmt.Sprintf("<@%s> - Enqueued stream **%s** to be played.", m.Author.ID, song)), m)
 		return
 	}
-	song := splitString[1]
 	result, err := b.yt.SearchFirstResult(song)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"song":  song,
 			"error": err,
 		}).Debug("Failed to find song")
-		b.reply(fmt.Sprintf("<@%s> - Sorry, couldn't find a result for: **%s**", m.Author.ID, song), m)
+		b.sendMessage(errorMessage(m.Author.ID, fmt.Sprintf("Sorry, couldn't find a result for: **%s**", song)), m)
 		return
 	}
-	b.textChannelLookup[m.ChannelID].player.playlist.addSong(m.Author, m.ChannelID, result.ID.VideoID, result.Snippet.Title)
-	go b.textChannelLookup[m.ChannelID].player.downloadNextSong()
-	b.reply(fmt.Sprintf("<@%s> - Enqueued **%s** to be played.", m.Author.ID, result.Snippet.Title), m)
+	entry := PlaylistEntry{
+		Title:     result.Snippet.Title,
+		VideoID:   result.ID.VideoID,
+		Live:      result.Snippet.LiveBroadcastContent == "live",
+		Channel:   result.Snippet.ChannelTitle,
+		Thumbnail: result.Snippet.Thumbnails.High.URL,
+	}
+	if !entry.Live {
+		maxLength := time.Duration(b.conf.Bot.MaxSongLength) * time.Second
+		details, err := b.yt.VideoDetails([]string{entry.VideoID})
+		if songDetails, found := details[entry.VideoID]; found {
+			entry.setDetails(songDetails)
+		} else {
+			log.WithFields(log.Fields{
+				"song":  entry.VideoID,
+				"error": err,
+			}).Debug("Failed to look up song details")
+			entry.Duration = int(songLength(b.yt, result, maxLength) / time.Second)
+		}
+		if maxLength > 0 && entry.Duration <= 0 {
+			b.sendMessage(errorMessage(m.Author.ID, fmt.Sprintf("Sorry, couldn't check how long **%s** is, songs can be at most %s.",
+				entry.Title, formatDuration(maxLength))), m)
+			return
+		}
+		if maxLength > 0 && entry.length() > maxLength {
+			b.sendMessage(errorMessage(m.Author.ID, fmt.Sprintf("Sorry, **%s** is too long (%s), songs can be at most %s.",
+				entry.Title, formatDuration(entry.length()), formatDuration(maxLength))), m)
+			return
+		}
+	}
+	b.textChannelLookup[m.ChannelID].player.playlist.addEntry(m.Author, m.ChannelID, entry)
+	b.textChannelLookup[m.ChannelID].player.stats.recordRequest(m.Author, entry.VideoID, entry.Title)
+	b.textChannelLookup[m.ChannelID].player.songAdded()
+	entry.Requester = m.Author
+	b.sendMessage(enqueuedMessage(m.Author.ID, &entry,
+		fmt.Sprintf("<@%s> - Enqueued **%s** [%s] to be played.", m.Author.ID, entry.Title, entry.displayLength())), m)
 }
 
-func skipSong(b *Bot, m *discordgo.MessageCreate) {
-	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
-		log.WithFields(log.Fields{
-			"channel": m.ChannelID,
-		}).Error("Failed to find controller from channel id")
-		return
+// songLength is how long a search result is, for when its details couldn't be
+// looked up, such as when there is no api key. Keyless search backends include
+// the length, otherwise the song is extracted to find it, but only if the
+// length must be checked against maxLength. Returns 0 if it isn't known.
+func songLength(yt *youtube.Manager, result youtube.SearchResult, maxLength time.Duration) time.Duration {
+	if result.Duration > 0 || maxLength <= 0 {
+		return result.Duration
 	}
-	textChannelInfo, err := b.dg.Channel(m.ChannelID)
+	audio, err := yt.Extract(result.ID.VideoID)
 	if err != nil {
-		log.Error("Failed to determine text channel info")
-		return
+		log.WithFields(log.Fields{
+			"song":  result.ID.VideoID,
+			"error": err,
+		}).Debug("Failed to extract song to find its length")
+		return 0
+	}
+	return audio.Duration
+}
+
+// enqueuedMessage confirms a song was added to the request queue.
+func enqueuedMessage(userID string, song *PlaylistEntry, text string) botMessage {
+	return botMessage{
+		kind:        messageEnqueued,
+		mentionID:   userID,
+		title:       "Enqueued",
+		description: fmt.Sprintf("**%s**", song.displayTitle()),
+		fields:      songFields(song),
+		thumbnail:   song.Thumbnail,
+		text:        text,
+	}
+}
+
+// isExternalURL checks if a play request is a link to somewhere other than
+// youtube, rather than something to search youtube for.
+func isExternalURL(request string) bool {
+	linkURL, err := url.Parse(request)
+	if err != nil || (linkURL.Scheme != "http" && linkURL.Scheme != "https") || linkURL.Host == "" {
+		return false
 	}
-	gID := textChannelInfo.GuildID
-	guildInfo, err := b.dg.Guild(gID)
+	host := strings.TrimPrefix(strings.ToLower(linkURL.Hostname()), "www.")
+	return host != "youtube.com" && host != "m.youtube.com" && host != "youtu.be"
+}
+
+// voiceListeners counts the users in the voice channel the bot plays in,
+// including the bot, and checks if the user is one of them.
+func (b *Bot) voiceListeners(gControl *guildControls, userID string) (int, bool, error) {
+	guildInfo, err := b.dg.State.Guild(gControl.guildID)
 	if err != nil {
-		log.Error("Failed to determine guild info")
-		return
+		return 0, false, err
 	}
 	numListeners := 0
-	foundRequester := false
+	foundUser := false
 	for _, vs := range guildInfo.VoiceStates {
-		if b.textChannelLookup[m.ChannelID].voiceChannelID != vs.ChannelID {
+		if gControl.voiceChannelID != vs.ChannelID {
 			continue
 		}
 		numListeners = numListeners + 1
-		if m.Author.ID == vs.UserID {
-			foundRequester = true
+		if userID == vs.UserID {
+			foundUser = true
 		}
 	}
-	if !foundRequester {
-		b.reply(fmt.Sprintf("<@%s> - You are not even listening, you don't get to skip!", m.Author.ID), m)
+	return numListeners, foundUser, nil
+}
+
+// otherListeners counts the users in the voice channel besides the bot and
+// the author.
+func (b *Bot) otherListeners(m *commandContext) (int, bool) {
+	numListeners, _, err := b.voiceListeners(b.textChannelLookup[m.ChannelID], m.Author.ID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"guild": b.textChannelLookup[m.ChannelID].guildID,
+			"error": err,
+		}).Error("Failed to determine guild info")
+		return 0, false
+	}
+	return numListeners - 2, true
+}
+
+func skipSong(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	otherListeners, ok := b.otherListeners(m)
+	if !ok {
 		return
 	}
-	message := b.textChannelLookup[m.ChannelID].player.Skip(numListeners-1, m.Author.ID)
+	message := b.textChannelLookup[m.ChannelID].player.Skip(otherListeners+1, m.Author.ID)
 	b.reply(message, m)
 }
 
-func savePlaylist(b *Bot, m *discordgo.MessageCreate) {
+func pauseSong(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	p := b.textChannelLookup[m.ChannelID].player
+	if !p.pauseByUser() {
+		b.reply(fmt.Sprintf("<@%s> - Nothing is playing right now.", m.Author.ID), m)
+		return
+	}
+	p.refreshControlPanel()
+	b.reply(fmt.Sprintf("<@%s> - Paused, use %sresume to keep listening.", m.Author.ID, b.conf.CommandPrefix), m)
+}
+
+func resumeSong(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	p := b.textChannelLookup[m.ChannelID].player
+	if !p.resumeByUser() {
+		b.reply(fmt.Sprintf("<@%s> - Nothing is paused right now.", m.Author.ID), m)
+		return
+	}
+	p.refreshControlPanel()
+	b.reply(fmt.Sprintf("<@%s> - Resumed.", m.Author.ID), m)
+}
+
+func loopSong(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	p := b.textChannelLookup[m.ChannelID].player
+	looping := p.toggleLoop()
+	p.refreshControlPanel()
+	if looping {
+		b.reply(fmt.Sprintf("<@%s> - Looping the current song.", m.Author.ID), m)
+	} else {
+		b.reply(fmt.Sprintf("<@%s> - Stopped looping.", m.Author.ID), m)
+	}
+}
+
+func shuffleQueue(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	shuffled := b.textChannelLookup[m.ChannelID].player.playlist.shuffleRequests()
+	if shuffled <= 1 {
+		b.reply(fmt.Sprintf("<@%s> - There isn't enough in the queue to shuffle.", m.Author.ID), m)
+		return
+	}
+	b.reply(fmt.Sprintf("<@%s> - Shuffled %d queued songs.", m.Author.ID, shuffled), m)
+}
+
+// stopPlayer clears the queue and stops the current song. Since this affects
+// everyone listening, only the bot owner or a listener who is alone can stop.
+func stopPlayer(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	otherListeners, ok := b.otherListeners(m)
+	if !ok {
+		return
+	}
+	if otherListeners > 0 && m.Author.ID != b.conf.OwnerID {
+		b.reply(fmt.Sprintf("<@%s> - Others are listening, vote to skip instead.", m.Author.ID), m)
+		return
+	}
+	removed := b.textChannelLookup[m.ChannelID].player.stop()
+	b.reply(fmt.Sprintf("<@%s> - Stopped, removed %d queued songs.", m.Author.ID, removed), m)
+}
+
+func savePlaylist(b *Bot, m *commandContext) {
 	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
 		log.WithFields(log.Fields{
 			"channel": m.ChannelID,
@@ -147,12 +662,182 @@ func savePlaylist(b *Bot, m *discordgo.MessageCreate) {
 	}
 }
 
-func printPlaylist(b *Bot, m *discordgo.MessageCreate) {
+func showQueue(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	page := m.args.number("page", 1)
+	gControl := b.textChannelLookup[m.ChannelID]
+	message, page, pages := queueMessage(gControl.player, m.Author.ID, page)
+	msg, err := b.sendMessage(message, m)
+	if err != nil || pages <= 1 {
+		return
+	}
+	b.dg.MessageReactionAdd(msg.ChannelID, msg.ID, queuePrevPageEmoji)
+	b.dg.MessageReactionAdd(msg.ChannelID, msg.ID, queueNextPageEmoji)
+	b.queueViews.add(msg.ID, &queueView{
+		channelID: msg.ChannelID,
+		userID:    m.Author.ID,
+		page:      page,
+		gControl:  gControl,
+		createdAt: time.Now(),
+	})
+}
+
+func showHistory(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	count := m.args.number("count", defaultHistoryCount)
+	if count > maxHistoryCount {
+		count = maxHistoryCount
+	}
+	requesterID := m.args.text("user")
+	title := "Recently Played"
+	for _, user := range m.Mentions {
+		if user.ID == requesterID {
+			title = fmt.Sprintf("Recently Played for %s", user.Username)
+		}
+	}
+	entries := b.textChannelLookup[m.ChannelID].player.history.recent(count, requesterID)
+	var historyString string
+	if len(entries) == 0 {
+		historyString = "\tEmpty"
+	}
+	for i, entry := range entries {
+		requester := "Playlist"
+		if entry.RequesterName != "" {
+			requester = entry.RequesterName
+		} else if entry.Autoplayed {
+			requester = "Autoplay"
+		}
+		historyString = historyString + fmt.Sprintf("\t%d. [%s] %s - Requester: %s (%s)\n",
+			i+1, entry.PlayedAt.Format("2006-01-02 15:04"), truncateTitle(entry.Title), requester, entry.Outcome)
+	}
+	b.reply(fmt.Sprintf("<@%s> - **%s**\n```%s```", m.Author.ID, title, historyString), m)
+}
+
+func showStats(b *Bot, m *commandContext) {
 	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
 		log.WithFields(log.Fields{
 			"channel": m.ChannelID,
 		}).Error("Failed to find controller from channel id")
 		return
 	}
-	b.reply(fmt.Sprintf("<@%s> - **Current Playlist**\n\n%s", m.Author.ID, b.textChannelLookup[m.ChannelID].player.playlist), m)
+	numDays := b.conf.Bot.StatsWindowDays
+	if m.args.text("days") == "all" {
+		numDays = 0
+	} else {
+		numDays = m.args.number("days", numDays)
+	}
+	window := "All Time"
+	if numDays > 0 {
+		window = fmt.Sprintf("Last %d Days", numDays)
+	}
+	summary := b.textChannelLookup[m.ChannelID].player.stats.summary(numDays)
+	msg := fmt.Sprintf("<@%s> - **Stats (%s)**\nTotal listening time: **%s**\n", m.Author.ID, window, summary.listeningTime())
+	msg = msg + fmt.Sprintf("**Most Requested:**\n```%s```", formatStatCounts(summary.topRequested(statsTopCount), "requests"))
+	msg = msg + fmt.Sprintf("**Top Requesters:**\n```%s```", formatStatCounts(summary.topRequesters(statsTopCount), "requests"))
+	msg = msg + fmt.Sprintf("**Most Skipped:**\n```%s```", formatStatCounts(summary.topSkipped(statsTopCount), "skips"))
+	b.reply(msg, m)
+}
+
+func formatStatCounts(counts []statCount, unit string) string {
+	if len(counts) == 0 {
+		return "\tNone"
+	}
+	var countString string
+	for i, c := range counts {
+		countString = countString + fmt.Sprintf("\t%d. %s - %d %s\n", i+1, truncateTitle(c.name), c.count, unit)
+	}
+	return countString
+}
+
+func playFavorites(b *Bot, m *commandContext) {
+	favs := b.favorites.list(m.Author.ID)
+	if len(favs) == 0 {
+		b.reply(fmt.Sprintf("<@%s> - You don't have any favorites yet, use **%sfav** while a song is playing.", m.Author.ID, b.conf.CommandPrefix), m)
+		return
+	}
+	for _, fav := range favs {
+		b.textChannelLookup[m.ChannelID].player.playlist.addEntry(m.Author, m.ChannelID, fav)
+		b.textChannelLookup[m.ChannelID].player.stats.recordRequest(m.Author, fav.id(), fav.Title)
+	}
+	b.textChannelLookup[m.ChannelID].player.songAdded()
+	b.reply(fmt.Sprintf("<@%s> - Enqueued **%d** of your favorites to be played.", m.Author.ID, len(favs)), m)
+}
+
+func likeSong(b *Bot, m *commandContext) {
+	rateSong(b, m, voteLike)
+}
+
+func dislikeSong(b *Bot, m *commandContext) {
+	rateSong(b, m, voteDislike)
+}
+
+func rateSong(b *Bot, m *commandContext, vote int) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	p := b.textChannelLookup[m.ChannelID].player
+	song := p.rateCurrentSong(m.Author.ID, vote)
+	if song == nil {
+		b.reply(fmt.Sprintf("<@%s> - Nothing is playing right now.", m.Author.ID), m)
+		return
+	}
+	likes, dislikes := p.ratings.score(song.id())
+	b.reply(fmt.Sprintf("<@%s> - Rated **%s**, it now has %d likes and %d dislikes.", m.Author.ID, song.Title, likes, dislikes), m)
+}
+
+func favoriteSong(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	current := b.textChannelLookup[m.ChannelID].player.nowPlaying()
+	if current == nil {
+		b.reply(fmt.Sprintf("<@%s> - Nothing is playing right now.", m.Author.ID), m)
+		return
+	}
+	if !b.favorites.add(m.Author.ID, current) {
+		b.reply(fmt.Sprintf("<@%s> - **%s** is already one of your favorites.", m.Author.ID, current.Title), m)
+		return
+	}
+	b.reply(fmt.Sprintf("<@%s> - Added **%s** to your favorites.", m.Author.ID, current.Title), m)
+}
+
+func nowPlaying(b *Bot, m *commandContext) {
+	if _, ok := b.textChannelLookup[m.ChannelID]; !ok {
+		log.WithFields(log.Fields{
+			"channel": m.ChannelID,
+		}).Error("Failed to find controller from channel id")
+		return
+	}
+	p := b.textChannelLookup[m.ChannelID].player
+	current := p.nowPlaying()
+	if current == nil {
+		b.reply(fmt.Sprintf("<@%s> - Nothing is playing right now.", m.Author.ID), m)
+		return
+	}
+	requester := "Autoplay"
+	if current.Requester != nil {
+		requester = current.Requester.Username
+	}
+	position := formatDuration(p.playbackPosition())
+	if !current.Live {
+		position = position + " / " + current.displayLength()
+	}
+	b.reply(fmt.Sprintf("<@%s> - Now playing **%s** (%s), requested by %s", m.Author.ID, current.displayTitle(),
+		position, requester), m)
 }
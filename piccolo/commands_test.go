@@ -0,0 +1,34 @@
+package piccolo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCooldownLeft(t *testing.T) {
+	h := newCommandHandler()
+	slow := &commandInfo{name: "slow", cooldown: time.Hour}
+	fast := &commandInfo{name: "fast", cooldown: time.Millisecond}
+	if left := h.cooldownLeft(slow, "user"); left != 0 {
+		t.Fatalf("First use has a cooldown of %s", left)
+	}
+	if left := h.cooldownLeft(slow, "user"); left <= 0 {
+		t.Fatal("Second use didn't have a cooldown")
+	}
+	if left := h.cooldownLeft(slow, "other"); left != 0 {
+		t.Fatalf("Another user has a cooldown of %s", left)
+	}
+	time.Sleep(5 * time.Millisecond)
+	// Using a command with a shorter cooldown must not forget the longer one
+	if left := h.cooldownLeft(fast, "user"); left != 0 {
+		t.Fatalf("Fast command has a cooldown of %s", left)
+	}
+	if left := h.cooldownLeft(slow, "user"); left <= 0 {
+		t.Fatal("Slow command cooldown was forgotten")
+	}
+	time.Sleep(5 * time.Millisecond)
+	h.cooldownLeft(fast, "other")
+	if _, ok := h.cooldowns["fast:user"]; ok {
+		t.Error("Expired cooldown wasn't pruned")
+	}
+}
@@ -0,0 +1,186 @@
+package piccolo
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/jatgam/goutils/log"
+)
+
+// controlPrefix starts the custom id of every control panel button, the rest
+// of the id is the command the button runs.
+const controlPrefix = "control:"
+
+// pauseByUser pauses the current song until a user resumes it. Unlike a pause
+// because nobody is listening, people joining the voice channel don't resume
+// it. Returns false if nothing is playing.
+func (p *player) pauseByUser() bool {
+	if state := p.getState(); state != statePlaying && state != statePaused {
+		return false
+	}
+	p.stateLock.Lock()
+	p.pausedByUser = true
+	p.stateLock.Unlock()
+	p.Pause()
+	return true
+}
+
+// resumeByUser resumes a song a user paused. Returns false if nothing is
+// paused.
+func (p *player) resumeByUser() bool {
+	if p.getState() != statePaused {
+		return false
+	}
+	p.stateLock.Lock()
+	p.pausedByUser = false
+	p.stateLock.Unlock()
+	p.Play()
+	return true
+}
+
+func (p *player) isPausedByUser() bool {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	return p.pausedByUser
+}
+
+// toggleLoop turns repeating the current song on or off, returning if it is
+// now on.
+func (p *player) toggleLoop() bool {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.looping = !p.looping
+	return p.looping
+}
+
+func (p *player) isLooping() bool {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	return p.looping
+}
+
+// stop clears the request queue and skips the current song. The player then
+// waits for a new request, rather than moving on to the auto playlist.
+// Returns how many queued songs were removed.
+func (p *player) stop() int {
+	removed := len(p.playlist.clearRequestQueue())
+	playing := false
+	p.stateLock.Lock()
+	p.looping = false
+	if p.state == statePlaying || p.state == statePaused {
+		p.stopRequested = true
+		playing = true
+	}
+	p.stateLock.Unlock()
+	if playing {
+		p.skipSong()
+	}
+	return removed
+}
+
+// takeStopRequest checks if the player was asked to stop, clearing the
+// request.
+func (p *player) takeStopRequest() bool {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	stopRequested := p.stopRequested
+	p.stopRequested = false
+	return stopRequested
+}
+
+// controlPanel is the row of buttons shown on the now playing message.
+func (p *player) controlPanel() []discordgo.MessageComponent {
+	pause := discordgo.Button{Label: "Pause", Emoji: discordgo.ComponentEmoji{Name: "⏸️"},
+		Style: discordgo.SecondaryButton, CustomID: controlPrefix + "pause"}
+	if p.getState() == statePaused {
+		pause = discordgo.Button{Label: "Resume", Emoji: discordgo.ComponentEmoji{Name: "▶️"},
+			Style: discordgo.PrimaryButton, CustomID: controlPrefix + "resume"}
+	}
+	loopStyle := discordgo.SecondaryButton
+	if p.isLooping() {
+		loopStyle = discordgo.SuccessButton
+	}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			pause,
+			discordgo.Button{Label: "Skip", Emoji: discordgo.ComponentEmoji{Name: "⏭️"},
+				Style: discordgo.SecondaryButton, CustomID: controlPrefix + "skip"},
+			discordgo.Button{Label: "Loop", Emoji: discordgo.ComponentEmoji{Name: "🔁"},
+				Style: loopStyle, CustomID: controlPrefix + "loop"},
+			discordgo.Button{Label: "Shuffle", Emoji: discordgo.ComponentEmoji{Name: "🔀"},
+				Style: discordgo.SecondaryButton, CustomID: controlPrefix + "shuffle"},
+			discordgo.Button{Label: "Stop", Emoji: discordgo.ComponentEmoji{Name: "⏹️"},
+				Style: discordgo.DangerButton, CustomID: controlPrefix + "stop"},
+		}},
+	}
+}
+
+// refreshControlPanel re-renders the now playing messages of the current
+// song, so their buttons match the state of the player.
+func (p *player) refreshControlPanel() {
+	song := p.playingSong()
+	if !p.conf.Bot.ControlPanel || song == nil {
+		return
+	}
+	message := p.nowPlayingMessage(song)
+	message.components = p.controlPanel()
+	if !p.conf.Bot.PersistentNowPlaying {
+		if channelID, messageID := p.nowPlayingMessageRef(); messageID != "" {
+			editMessage(p.dg, p.conf.Bot.UseEmbeds, channelID, messageID, message)
+		}
+		return
+	}
+	p.nowPlayingLock.Lock()
+	defer p.nowPlayingLock.Unlock()
+	for textChannelID, messageID := range p.nowPlayingMessages {
+		if messageID != "" {
+			editMessage(p.dg, p.conf.Bot.UseEmbeds, textChannelID, messageID, message)
+		}
+	}
+}
+
+// controlPanelPress runs the command behind a control panel button, exactly
+// as if the user had typed it, so the same rules apply. The reply is only
+// shown to the user who pressed the button.
+func (b *Bot) controlPanelPress(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, controlPrefix) {
+		return
+	}
+	gControl, ok := b.textChannelLookup[i.ChannelID]
+	if !ok || !gControl.player.isNowPlayingMessage(i.Message.ID) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Sorry, these controls are for a song that isn't playing anymore.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+	commandName := strings.TrimPrefix(customID, controlPrefix)
+	m := newInteractionContext(i, b.conf.CommandPrefix+commandName)
+	if !b.deferInteraction(s, i, commandName, discordgo.MessageFlagsEphemeral) {
+		return
+	}
+	b.runInteraction(s, m, commandName)
+}
+
+// deferInteraction lets discord know a command is being run, the response is
+// filled in when the command replies. Returns false if the interaction can't
+// be answered.
+func (b *Bot) deferInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, commandName string, flags discordgo.MessageFlags) bool {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: flags},
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cmd":   commandName,
+			"error": err,
+		}).Error("Failed to respond to interaction")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package piccolo
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/jatgam/goutils/log"
+)
+
+type (
+	pendingDeletion struct {
+		channelID string
+		messageID string
+		deleteAt  time.Time
+	}
+
+	// deletionQueue is a heap of pending deletions, the next one due first.
+	deletionQueue []*pendingDeletion
+
+	// deleteScheduler deletes messages once their delay is up. A single
+	// goroutine waits on whichever deletion is due next, so any number of
+	// messages can be waiting to be deleted.
+	deleteScheduler struct {
+		dg       *discordgo.Session
+		pending  deletionQueue
+		wake     chan struct{}
+		stopChan chan struct{}
+		lock     *sync.Mutex
+	}
+)
+
+func (q deletionQueue) Len() int            { return len(q) }
+func (q deletionQueue) Less(i, j int) bool  { return q[i].deleteAt.Before(q[j].deleteAt) }
+func (q deletionQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *deletionQueue) Push(x interface{}) { *q = append(*q, x.(*pendingDeletion)) }
+func (q *deletionQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+func newDeleteScheduler(dg *discordgo.Session) *deleteScheduler {
+	d := &deleteScheduler{
+		dg:       dg,
+		wake:     make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+		lock:     &sync.Mutex{},
+	}
+	go d.run()
+	return d
+}
+
+// schedule deletes a message after delay.
+func (d *deleteScheduler) schedule(channelID string, messageID string, delay time.Duration) {
+	if messageID == "" {
+		return
+	}
+	d.lock.Lock()
+	heap.Push(&d.pending, &pendingDeletion{channelID: channelID, messageID: messageID, deleteAt: time.Now().Add(delay)})
+	d.lock.Unlock()
+	// Wake the scheduler in case this deletion is due before the one it is
+	// waiting on
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop ends the scheduler, messages still waiting are not deleted.
+func (d *deleteScheduler) stop() {
+	close(d.stopChan)
+}
+
+// due removes and returns every deletion that is due, along with how long
+// until the next one.
+func (d *deleteScheduler) due() ([]*pendingDeletion, time.Duration, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var due []*pendingDeletion
+	for d.pending.Len() > 0 {
+		next := d.pending[0]
+		if wait := time.Until(next.deleteAt); wait > 0 {
+			return due, wait, true
+		}
+		due = append(due, heap.Pop(&d.pending).(*pendingDeletion))
+	}
+	return due, 0, false
+}
+
+func (d *deleteScheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		due, wait, waiting := d.due()
+		for _, deletion := range due {
+			err := d.dg.ChannelMessageDelete(deletion.channelID, deletion.messageID)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"channel": deletion.channelID,
+					"message": deletion.messageID,
+					"error":   err,
+				}).Warn("Failed to delete message")
+			}
+		}
+		var timerChan <-chan time.Time
+		if waiting {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			timerChan = timer.C
+		}
+		select {
+		case <-timerChan:
+		case <-d.wake:
+		case <-d.stopChan:
+			return
+		}
+	}
+}
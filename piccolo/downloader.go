@@ -0,0 +1,196 @@
+package piccolo
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jatgam/goutils/log"
+
+	"github.com/shawnsilva/piccolo/youtube"
+)
+
+// failedDownloadTTL is how long a failed download is remembered, so the same
+// song isn't retried over and over.
+const failedDownloadTTL = 10 * time.Minute
+
+type (
+	// downloadManager is shared by every guild, it limits how many songs are
+	// downloaded at once and makes sure each song is only downloaded once,
+	// no matter how many guilds want it.
+	downloadManager struct {
+		yt         *youtube.Manager
+		workers    chan struct{}
+		retries    int
+		retryDelay time.Duration
+		inFlight   map[string]*downloadJob
+		failed     map[string]*downloadJob
+		lock       *sync.Mutex
+	}
+
+	downloadJob struct {
+		videoID    string
+		done       chan struct{}
+		err        error
+		finishedAt time.Time
+		encoded    time.Duration
+		total      time.Duration
+		// partialPath is the file the current download attempt is written to
+		partialPath string
+		lock        *sync.Mutex
+	}
+)
+
+func newDownloadManager(yt *youtube.Manager, numWorkers int, retries int, retryDelay time.Duration) *downloadManager {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	return &downloadManager{
+		yt:         yt,
+		workers:    make(chan struct{}, numWorkers),
+		retries:    retries,
+		retryDelay: retryDelay,
+		inFlight:   make(map[string]*downloadJob),
+		failed:     make(map[string]*downloadJob),
+		lock:       &sync.Mutex{},
+	}
+}
+
+// queue starts downloading a song if it isn't already on disk or being
+// downloaded. The returned job can be waited on until the song is ready. If the
+// song recently failed to download, the failed job is returned instead.
+func (d *downloadManager) queue(videoID string) *downloadJob {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if job, ok := d.inFlight[videoID]; ok {
+		return job
+	}
+	if job, ok := d.failed[videoID]; ok {
+		if time.Since(job.finishedAt) < failedDownloadTTL {
+			return job
+		}
+		delete(d.failed, videoID)
+	}
+	job := &downloadJob{videoID: videoID, done: make(chan struct{}), lock: &sync.Mutex{}}
+	if _, err := os.Stat(filepath.FromSlash(d.yt.DCAPath(videoID))); err == nil {
+		close(job.done)
+		return job
+	}
+	d.inFlight[videoID] = job
+	go d.run(job)
+	return job
+}
+
+// recentlyFailed checks if a song failed to download too recently to be tried
+// again.
+func (d *downloadManager) recentlyFailed(videoID string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	job, ok := d.failed[videoID]
+	return ok && time.Since(job.finishedAt) < failedDownloadTTL
+}
+
+// nextRetry is how long until a song that failed to download can be tried
+// again, 0 if no song is waiting to be.
+func (d *downloadManager) nextRetry() time.Duration {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var next time.Duration
+	for _, job := range d.failed {
+		left := failedDownloadTTL - time.Since(job.finishedAt)
+		if left > 0 && (next == 0 || left < next) {
+			next = left
+		}
+	}
+	return next
+}
+
+func (d *downloadManager) run(job *downloadJob) {
+	d.workers <- struct{}{}
+	defer func() {
+		<-d.workers
+		d.lock.Lock()
+		delete(d.inFlight, job.videoID)
+		job.finishedAt = time.Now()
+		if job.err != nil {
+			d.failed[job.videoID] = job
+		}
+		d.lock.Unlock()
+		close(job.done)
+	}()
+	songFilePath := filepath.FromSlash(d.yt.DCAPath(job.videoID))
+	if _, err := os.Stat(songFilePath); err == nil {
+		log.WithFields(log.Fields{
+			"song": songFilePath,
+		}).Debug("Song already downloaded")
+		return
+	}
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			// Back off a little more after each failure
+			backoff := d.retryDelay * time.Duration(1<<uint(attempt-1))
+			log.WithFields(log.Fields{
+				"song":    job.videoID,
+				"attempt": attempt,
+				"backoff": backoff,
+			}).Warn("Retrying song download")
+			time.Sleep(backoff)
+		}
+		log.WithFields(log.Fields{
+			"song": songFilePath,
+		}).Debug("Downloading song")
+		_, job.err = d.yt.DownloadDCAAudioWithProgress(job.videoID, job.setPartialPath, job.setProgress)
+		if job.err == nil {
+			return
+		}
+		log.WithFields(log.Fields{
+			"song":  job.videoID,
+			"error": job.err,
+		}).Error("Failed to download song")
+	}
+}
+
+// wait blocks until the download has finished, returning any error downloading
+// it.
+func (j *downloadJob) wait() error {
+	<-j.done
+	return j.err
+}
+
+func (j *downloadJob) setProgress(encoded time.Duration, total time.Duration) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.encoded = encoded
+	j.total = total
+}
+
+func (j *downloadJob) setPartialPath(partialPath string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.partialPath = partialPath
+}
+
+// currentPartialPath is the file the download is being written to, empty if
+// the download hasn't started yet.
+func (j *downloadJob) currentPartialPath() string {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.partialPath
+}
+
+func (j *downloadJob) progress() (encoded time.Duration, total time.Duration) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.encoded, j.total
+}
+
+// finished checks if the download is done, without blocking.
+func (j *downloadJob) finished() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,112 @@
+package piccolo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/jatgam/goutils/log"
+)
+
+type (
+	// FavoritesJSON is used to handle marshalling and unmarshalling each users
+	// favorite songs to a file on disk
+	FavoritesJSON struct {
+		Users map[string][]PlaylistEntry `json:"users"`
+	}
+
+	favorites struct {
+		users         map[string][]PlaylistEntry
+		favoritesPath string
+		lock          *sync.Mutex
+	}
+)
+
+func newFavorites(favoritesPath string) *favorites {
+	f := &favorites{users: make(map[string][]PlaylistEntry), favoritesPath: favoritesPath, lock: &sync.Mutex{}}
+	f.loadFavorites()
+	return f
+}
+
+func (f *favorites) loadFavorites() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	favoritesFileContents, err := ioutil.ReadFile(filepath.FromSlash(f.favoritesPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(f.favoritesPath),
+			"error": err,
+		}).Error("Failed to open favorites file to read")
+		return fmt.Errorf("Couldn't read the favorites file")
+	}
+	var fileFavorites = FavoritesJSON{}
+	jsonErr := json.Unmarshal(favoritesFileContents, &fileFavorites)
+	if jsonErr != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(f.favoritesPath),
+			"error": jsonErr,
+		}).Error("Failed to decode favorites json")
+		return fmt.Errorf("Couldn't decode the favorites file")
+	}
+	if fileFavorites.Users != nil {
+		f.users = fileFavorites.Users
+	}
+	log.Debug("Loaded favorites")
+	return nil
+}
+
+// saveFavorites must be called with the favorites lock held.
+func (f *favorites) saveFavorites() error {
+	favoritesDir := filepath.FromSlash(path.Dir(f.favoritesPath))
+	if _, err := os.Stat(favoritesDir); os.IsNotExist(err) {
+		err := os.MkdirAll(favoritesDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	jsonFavorites, _ := json.MarshalIndent(&FavoritesJSON{Users: f.users}, "", "    ")
+	err := ioutil.WriteFile(filepath.FromSlash(f.favoritesPath), jsonFavorites, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(f.favoritesPath),
+			"error": err,
+		}).Error("Failed to write favorites json file")
+		return fmt.Errorf("Error saving favorites file")
+	}
+	return nil
+}
+
+// add puts a song in the users favorites, returning false if it was already
+// one of their favorites.
+func (f *favorites) add(userID string, song *PlaylistEntry) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, fav := range f.users[userID] {
+		if fav.id() == song.id() {
+			return false
+		}
+	}
+	// Only keep what is saved in a playlist, not who requested it
+	fav := *song
+	fav.Requester = nil
+	fav.RequestChannelID = ""
+	fav.Autoplayed = false
+	f.users[userID] = append(f.users[userID], fav)
+	f.saveFavorites()
+	return true
+}
+
+func (f *favorites) list(userID string) []PlaylistEntry {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	userFavorites := make([]PlaylistEntry, len(f.users[userID]))
+	copy(userFavorites, f.users[userID])
+	return userFavorites
+}
@@ -0,0 +1,175 @@
+package piccolo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jatgam/goutils/log"
+)
+
+const (
+	historyFinished = "finished"
+	historySkipped  = "skipped"
+	historyErrored  = "error"
+	historyStopped  = "stopped"
+	historyFailed   = "failed"
+)
+
+type (
+	// HistoryEntry is a single song that was played by the bot
+	HistoryEntry struct {
+		PlayedAt      time.Time `json:"playedAt"`
+		GuildID       string    `json:"guildID"`
+		RequesterID   string    `json:"requesterID,omitempty"`
+		RequesterName string    `json:"requesterName,omitempty"`
+		Title         string    `json:"title"`
+		VideoID       string    `json:"videoID"`
+		StreamURL     string    `json:"streamURL,omitempty"`
+		Autoplayed    bool      `json:"autoplayed,omitempty"`
+		Outcome       string    `json:"outcome"`
+	}
+
+	// HistoryJSON is used to handle marshalling and unmarshalling the play
+	// history to a file on disk
+	HistoryJSON struct {
+		Entries []HistoryEntry `json:"entries"`
+	}
+
+	history struct {
+		entries     []HistoryEntry
+		maxEntries  int
+		historyPath string
+		lock        *sync.Mutex
+	}
+)
+
+func newHistory(historyPath string, maxEntries int) *history {
+	h := &history{historyPath: historyPath, maxEntries: maxEntries, lock: &sync.Mutex{}}
+	h.loadHistory()
+	return h
+}
+
+func (h *history) loadHistory() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	historyFileContents, err := ioutil.ReadFile(filepath.FromSlash(h.historyPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(h.historyPath),
+			"error": err,
+		}).Error("Failed to open history file to read")
+		return fmt.Errorf("Couldn't read the history file")
+	}
+	var fileHistory = HistoryJSON{}
+	jsonErr := json.Unmarshal(historyFileContents, &fileHistory)
+	if jsonErr != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(h.historyPath),
+			"error": jsonErr,
+		}).Error("Failed to decode history json")
+		return fmt.Errorf("Couldn't decode the history file")
+	}
+	h.entries = fileHistory.Entries
+	h.trim()
+	log.Debug("Loaded history")
+	return nil
+}
+
+// saveHistory must be called with the history lock held.
+func (h *history) saveHistory() error {
+	historyDir := filepath.FromSlash(path.Dir(h.historyPath))
+	if _, err := os.Stat(historyDir); os.IsNotExist(err) {
+		err := os.MkdirAll(historyDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	jsonHistory, _ := json.MarshalIndent(&HistoryJSON{Entries: h.entries}, "", "    ")
+	err := ioutil.WriteFile(filepath.FromSlash(h.historyPath), jsonHistory, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(h.historyPath),
+			"error": err,
+		}).Error("Failed to write history json file")
+		return fmt.Errorf("Error saving history file")
+	}
+	return nil
+}
+
+func (h *history) trim() {
+	if h.maxEntries > 0 && len(h.entries) > h.maxEntries {
+		h.entries = h.entries[len(h.entries)-h.maxEntries:]
+	}
+}
+
+func (h *history) addSong(guildID string, song *PlaylistEntry, outcome string) {
+	entry := HistoryEntry{
+		PlayedAt:   time.Now(),
+		GuildID:    guildID,
+		Title:      song.Title,
+		VideoID:    song.VideoID,
+		StreamURL:  song.StreamURL,
+		Autoplayed: song.Autoplayed,
+		Outcome:    outcome,
+	}
+	if song.Requester != nil {
+		entry.RequesterID = song.Requester.ID
+		entry.RequesterName = song.Requester.Username
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.entries = append(h.entries, entry)
+	h.trim()
+	h.saveHistory()
+}
+
+// recent returns up to num of the most recently played songs, newest first. If
+// requesterID is not empty, only songs requested by that user are returned.
+func (h *history) recent(num int, requesterID string) []HistoryEntry {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var found []HistoryEntry
+	for i := len(h.entries) - 1; i >= 0 && len(found) < num; i-- {
+		if requesterID != "" && h.entries[i].RequesterID != requesterID {
+			continue
+		}
+		found = append(found, h.entries[i])
+	}
+	return found
+}
+
+// playedRecently checks if a song was one of the last num songs played. id is
+// the video id, or stream url for songs that aren't youtube videos.
+func (h *history) playedRecently(id string, num int) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i := len(h.entries) - 1; i >= 0 && i >= len(h.entries)-num; i-- {
+		if h.entries[i].VideoID == id || (h.entries[i].VideoID == "" && h.entries[i].StreamURL == id) {
+			return true
+		}
+	}
+	return false
+}
+
+func historyOutcome(streamErr error) string {
+	switch streamErr {
+	case nil, io.EOF:
+		return historyFinished
+	case errSkip:
+		return historySkipped
+	case errShutdown:
+		return historyStopped
+	default:
+		return historyErrored
+	}
+}
@@ -0,0 +1,203 @@
+package piccolo
+
+import (
+	"fmt"
+
+	"github.com/jatgam/goutils/log"
+)
+
+// nowPlayingScrollLimit is how many messages can be posted after a persistent
+// now playing message before it is re-posted at the bottom of the channel.
+const nowPlayingScrollLimit = 10
+
+// nowPlayingMessage describes the song that just started. The requester is
+// only mentioned if now playing mentions are enabled, and never in persistent
+// messages since editing a message doesn't notify anyone.
+func (p *player) nowPlayingMessage(song *songAndPath) botMessage {
+	message := botMessage{
+		kind:        messageNowPlaying,
+		title:       "Now Playing",
+		description: fmt.Sprintf("**%s**", song.displayTitle()),
+		fields:      songFields(song.PlaylistEntry),
+		thumbnail:   song.Thumbnail,
+		text:        fmt.Sprintf("Now playing: **%s**", song.displayTitle()),
+	}
+	if p.conf.Bot.NowPlayingMentions && !p.conf.Bot.PersistentNowPlaying && song.Requester != nil {
+		message.mentionID = song.Requester.ID
+		message.text = fmt.Sprintf("<@%s> - Your song is now playing: **%s**", song.Requester.ID, song.displayTitle())
+	}
+	return message
+}
+
+// announceChannel is where the now playing message of a song is posted, the
+// channel it was requested from, or for playlist and autoplay songs the first
+// text channel the bot is bound to. When the bot isn't bound to any channels,
+// songs nobody requested aren't announced.
+func (p *player) announceChannel(song *songAndPath) string {
+	if song.RequestChannelID != "" {
+		return song.RequestChannelID
+	}
+	if len(p.boundChannelIDs) > 0 {
+		return p.boundChannelIDs[0]
+	}
+	return ""
+}
+
+// announceSong lets the channel a song was requested from know it started
+// playing, songs nobody requested are announced too so they can be rated. In
+// persistent mode the now playing message of every channel is updated
+// instead.
+func (p *player) announceSong(song *songAndPath) {
+	message := p.nowPlayingMessage(song)
+	if p.conf.Bot.ControlPanel {
+		message.components = p.controlPanel()
+	}
+	if p.conf.Bot.PersistentNowPlaying {
+		p.updateNowPlaying(message, song.RequestChannelID, true)
+		return
+	}
+	channelID := p.announceChannel(song)
+	if channelID == "" {
+		return
+	}
+	msg, err := sendMessage(p.dg, p.conf.Bot.UseEmbeds, channelID, message)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msg":   msg,
+			"error": err,
+		}).Error("Failed to send message about request now playing")
+		return
+	}
+	p.setNowPlayingMessage(msg.ChannelID, msg.ID)
+	p.dg.MessageReactionAdd(msg.ChannelID, msg.ID, likeEmoji)
+	p.dg.MessageReactionAdd(msg.ChannelID, msg.ID, dislikeEmoji)
+}
+
+// songEnded cleans up the now playing message of a song that finished, if
+// messages aren't deleted its control panel is removed. Persistent messages
+// are kept for the next song.
+func (p *player) songEnded(song *songAndPath) {
+	channelID, messageID := p.nowPlayingMessageRef()
+	if p.conf.Bot.PersistentNowPlaying || messageID == "" {
+		return
+	}
+	if p.conf.Bot.DeleteMessages {
+		p.deletions.schedule(channelID, messageID, 0)
+	} else if p.conf.Bot.ControlPanel {
+		editMessage(p.dg, p.conf.Bot.UseEmbeds, channelID, messageID, p.nowPlayingMessage(song))
+	}
+}
+
+// setNowPlayingMessage remembers the now playing message of the current song.
+func (p *player) setNowPlayingMessage(channelID string, messageID string) {
+	p.nowPlayingLock.Lock()
+	defer p.nowPlayingLock.Unlock()
+	p.nowPlayingChannelID = channelID
+	p.nowPlayingMessageID = messageID
+}
+
+// nowPlayingMessageRef returns the channel and id of the now playing message
+// of the current song, empty if there isn't one.
+func (p *player) nowPlayingMessageRef() (string, string) {
+	p.nowPlayingLock.Lock()
+	defer p.nowPlayingLock.Unlock()
+	return p.nowPlayingChannelID, p.nowPlayingMessageID
+}
+
+// showIdle updates the persistent now playing messages when nothing is left
+// to play.
+func (p *player) showIdle() {
+	if !p.conf.Bot.PersistentNowPlaying {
+		return
+	}
+	text := "Nothing is playing, waiting for requests."
+	p.updateNowPlaying(botMessage{kind: messageInfo, title: "Now Playing", description: text, text: text}, "", false)
+}
+
+// updateNowPlaying edits the persistent now playing message in every channel
+// that has one, and channelID if it doesn't have one yet. Messages that have
+// scrolled too far up are re-posted at the bottom. rateable songs get the
+// rating reactions, any old reactions are cleared.
+func (p *player) updateNowPlaying(message botMessage, channelID string, rateable bool) {
+	p.nowPlayingLock.Lock()
+	defer p.nowPlayingLock.Unlock()
+	if _, ok := p.nowPlayingMessages[channelID]; channelID != "" && !ok {
+		p.nowPlayingMessages[channelID] = ""
+	}
+	for textChannelID, messageID := range p.nowPlayingMessages {
+		if messageID != "" && p.scrolledAway(textChannelID, messageID) {
+			p.dg.ChannelMessageDelete(textChannelID, messageID)
+			messageID = ""
+		}
+		if messageID != "" {
+			_, err := editMessage(p.dg, p.conf.Bot.UseEmbeds, textChannelID, messageID, message)
+			if err == nil {
+				p.dg.MessageReactionsRemoveAll(textChannelID, messageID)
+				if rateable {
+					p.dg.MessageReactionAdd(textChannelID, messageID, likeEmoji)
+					p.dg.MessageReactionAdd(textChannelID, messageID, dislikeEmoji)
+				}
+				continue
+			}
+			// The message was probably deleted, post a new one
+		}
+		msg, err := sendMessage(p.dg, p.conf.Bot.UseEmbeds, textChannelID, message)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"channel": textChannelID,
+				"error":   err,
+			}).Error("Failed to send now playing message")
+			delete(p.nowPlayingMessages, textChannelID)
+			continue
+		}
+		p.nowPlayingMessages[textChannelID] = msg.ID
+		if rateable {
+			p.dg.MessageReactionAdd(msg.ChannelID, msg.ID, likeEmoji)
+			p.dg.MessageReactionAdd(msg.ChannelID, msg.ID, dislikeEmoji)
+		}
+	}
+}
+
+// seedNowPlaying makes sure each channel gets a persistent now playing
+// message, including channels no song has been requested from yet.
+func (p *player) seedNowPlaying(channelIDs []string) {
+	if !p.conf.Bot.PersistentNowPlaying {
+		return
+	}
+	p.nowPlayingLock.Lock()
+	defer p.nowPlayingLock.Unlock()
+	for _, channelID := range channelIDs {
+		if _, ok := p.nowPlayingMessages[channelID]; !ok {
+			p.nowPlayingMessages[channelID] = ""
+		}
+	}
+}
+
+// scrolledAway checks if enough messages have been posted after a message
+// that it has scrolled out of view.
+func (p *player) scrolledAway(channelID string, messageID string) bool {
+	messages, err := p.dg.ChannelMessages(channelID, nowPlayingScrollLimit, "", messageID, "")
+	if err != nil {
+		return false
+	}
+	return len(messages) >= nowPlayingScrollLimit
+}
+
+// isNowPlayingMessage checks if a message shows the song currently playing,
+// so reactions to it rate the song.
+func (p *player) isNowPlayingMessage(messageID string) bool {
+	if messageID == "" {
+		return false
+	}
+	p.nowPlayingLock.Lock()
+	defer p.nowPlayingLock.Unlock()
+	if messageID == p.nowPlayingMessageID {
+		return true
+	}
+	for _, nowPlayingID := range p.nowPlayingMessages {
+		if nowPlayingID == messageID {
+			return true
+		}
+	}
+	return false
+}
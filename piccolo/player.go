@@ -24,46 +24,108 @@ type (
 	player struct {
 		conf           *utils.Config
 		playlist       *playlist
+		history        *history
+		stats          *stats
+		ratings        *ratings
 		guildID        string
 		voiceChannelID string
 		vc             *discordgo.VoiceConnection
 		stream         *dca.StreamingSession
 		yt             *youtube.Manager
 
-		streamDoneChan chan error
+		skipChan chan struct{}
+
+		// boundChannelIDs are the text channels the bot is bound to, empty
+		// if it takes commands in every channel
+		boundChannelIDs []string
 
 		currentSong *songAndPath
+		// lastVideoID and lastTitle are the last youtube song played, autoplay
+		// finds songs related to it. Guarded by stateLock.
+		lastVideoID string
+		lastTitle   string
+		// nowPlayingMessageID and nowPlayingChannelID are the now playing
+		// message of the current song, when messages aren't persistent
+		nowPlayingMessageID string
+		nowPlayingChannelID string
+		// nowPlayingMessages are the persistent now playing messages, keyed
+		// by text channel id
+		nowPlayingMessages map[string]string
+		// nowPlayingLock guards the now playing messages, they are read by the
+		// reaction and button handlers
+		nowPlayingLock *sync.Mutex
 
 		dg *discordgo.Session
 
-		downloadLock *sync.Mutex
+		downloads *downloadManager
+		cache     *cacheManager
+		deletions *deleteScheduler
+		// autoplayNext is the song picked to autoplay once nothing else is
+		// queued, autoplaySeed is the video it is related to. Guarded by
+		// autoplayLock.
+		autoplayNext *PlaylistEntry
+		autoplaySeed string
+		autoplayLock *sync.Mutex
+
+		state     playerState
+		stateLock *sync.Mutex
+		// pausedByUser, looping and stopRequested are set from the controls,
+		// and are protected by stateLock
+		pausedByUser   bool
+		looping        bool
+		stopRequested  bool
+		songQueuedChan chan struct{}
+		shutdownChan   chan struct{}
 	}
 
 	songAndPath struct {
 		fsPath         string
 		skipsRequested []string
+		download       *downloadJob
 		*PlaylistEntry
 	}
 )
 
 var errShutdown = errors.New("SHUTDOWN")
 var errSkip = errors.New("SKIP")
+var errPlaylistEmpty = errors.New("PLAYLIST EMPTY")
+
+const downloadProgressInterval = 10 * time.Second
 
-func newPlayer(confpointer *utils.Config, guildID string, voiceChID string, youtube *youtube.Manager, downloadLock *sync.Mutex, discordSession *discordgo.Session) *player {
+func newPlayer(confpointer *utils.Config, guildID string, voiceChID string, youtube *youtube.Manager, downloads *downloadManager, cache *cacheManager, deletions *deleteScheduler, discordSession *discordgo.Session) *player {
 	p := &player{conf: confpointer, guildID: guildID, voiceChannelID: voiceChID, yt: youtube, dg: discordSession}
-	p.playlist = newPlaylist(p.conf.Bot.UsePlaylist, p.conf.Bot.PlaylistPath)
-	p.downloadLock = downloadLock
-	p.streamDoneChan = make(chan error)
+	p.history = newHistory(path.Join(filepath.ToSlash(p.conf.Bot.DataDir), "history", guildID+".json"), p.conf.Bot.HistoryLength)
+	p.stats = newStats(path.Join(filepath.ToSlash(p.conf.Bot.DataDir), "stats", guildID+".json"), p.conf.Bot.StatsRetentionDays)
+	p.ratings = newRatings(path.Join(filepath.ToSlash(p.conf.Bot.DataDir), "ratings", guildID+".json"))
+	dislikeThreshold := 0
+	if p.conf.Bot.DropDislikedSongs {
+		dislikeThreshold = p.conf.Bot.DislikeThreshold
+	}
+	p.playlist = newPlaylist(p.conf.Bot.UsePlaylist, p.conf.Bot.PlaylistPath, p.history, p.conf.Bot.PlaylistNoRepeat, p.ratings, dislikeThreshold)
+	// Playlist songs that are failing to download are skipped, rather than
+	// tried over and over
+	p.playlist.unavailable = downloads.recentlyFailed
+	p.downloads = downloads
+	p.cache = cache
+	p.deletions = deletions
+	p.nowPlayingMessages = make(map[string]string)
+	p.nowPlayingLock = &sync.Mutex{}
+	p.autoplayLock = &sync.Mutex{}
+	p.skipChan = make(chan struct{}, 1)
+	p.state = stateStopped
+	p.stateLock = &sync.Mutex{}
+	p.songQueuedChan = make(chan struct{}, 1)
+	p.shutdownChan = make(chan struct{})
 	return p
 }
 
 func (p *player) Shutdown() error {
-	if p.stream != nil {
-		p.stream.SetPaused(true)
+	if stream := p.currentStream(); stream != nil {
+		stream.SetPaused(true)
 	}
-	p.downloadLock.Lock()
-	p.streamDoneChan <- errShutdown
-	p.stream = nil
+	p.setState(stateStopped)
+	close(p.shutdownChan)
+	p.setCurrent(nil, nil)
 	if p.vc != nil {
 		p.vc.Speaking(false)
 		err := p.vc.Disconnect()
@@ -81,106 +143,254 @@ func (p *player) JoinVoiceChannel() error {
 		return err
 	}
 	p.vc = vc
-	p.downloadNextSong()
+	go p.prefetchSongs()
 
+	p.setState(stateIdle)
 	go p.playLoop()
 	return nil
 }
 
 func (p *player) playLoop() {
+	var repeatSong *PlaylistEntry
 	for {
-		nextSong, err := p.getNextSongPath()
-		// Download the next song in the background
-		go p.downloadNextSong()
-		if err == nil {
-			reader, err := os.Open(filepath.FromSlash(nextSong.fsPath))
-			if err != nil {
-				continue
-			}
-			p.currentSong = nextSong
-			decoder := dca.NewDecoder(reader)
-			p.vc.Speaking(true)
-
-			p.stream = dca.NewStream(decoder, p.vc, p.streamDoneChan)
-			p.updateStatus()
-			if nextSong.Requester != nil && nextSong.RequestChannelID != "" {
-				// Message requester their song is playing
-				message := fmt.Sprintf("<@%s> - Your song is now playing: **%s**", nextSong.Requester.ID, nextSong.Title)
-				msg, err := p.dg.ChannelMessageSend(nextSong.RequestChannelID, message)
-				if err != nil {
-					log.WithFields(log.Fields{
-						"msg":   msg,
-						"error": err,
-					}).Error("Failed to send message about request now playing")
+		if !p.setState(stateLoading) {
+			// The player has been stopped
+			return
+		}
+		var nextSong *songAndPath
+		var err error
+		if repeatSong != nil {
+			// The song may have been removed from the cache since it played,
+			// so it is looked up again rather than reusing its old path
+			nextSong, err = p.songPath(repeatSong)
+			repeatSong = nil
+		} else {
+			nextSong, err = p.getNextSongPath()
+			if err == errPlaylistEmpty {
+				if song := p.takeAutoplaySong(); song != nil {
+					nextSong, err = p.songPath(song)
 				}
 			}
-			streamErr := <-p.streamDoneChan
-			if streamErr == errShutdown {
+		}
+		if err == errPlaylistEmpty {
+			if !p.idle() {
 				return
 			}
-			if streamErr != nil && streamErr != io.EOF && streamErr != errSkip {
-				// Handle the error
-				log.WithFields(log.Fields{
-					"error": streamErr,
-				}).Error("Error streaming song")
-				for !p.vc.Ready {
-					time.Sleep(time.Duration(2) * time.Second)
-				}
+			continue
+		}
+		if err == nil && !nextSong.Live {
+			p.setLastSong(nextSong.VideoID, nextSong.Title)
+		}
+		// Download the songs after this one in the background
+		go p.prefetchSongs()
+		if err != nil {
+			continue
+		}
+		err = p.playSong(nextSong)
+		if err == errShutdown {
+			return
+		}
+		if p.takeStopRequest() {
+			if p.playlist.hasRequests() {
+				// Something was requested since stopping
+				continue
+			}
+			// Forget any requests from before stopping
+			select {
+			case <-p.songQueuedChan:
+			default:
+			}
+			if !p.idle() {
+				return
 			}
-			p.vc.Speaking(false)
+			continue
+		}
+		if (err == nil || err == io.EOF) && p.isLooping() {
+			repeatSong = nextSong.PlaylistEntry
 		}
-		// Check if the next song is downloaded, if not block until it is. Catches
-		// additions to the request queue.
-		p.downloadNextSong()
 	}
 }
 
-func (p *player) updateStatus() {
-	if p.stream == nil {
-		p.dg.UpdateStatus(0, "Bot Stopped")
-		return
+// idle waits for a song to be requested, returning false if the player was
+// shutdown instead. Playlist songs are skipped while they are failing to
+// download, so the player also wakes when they can be tried again.
+func (p *player) idle() bool {
+	p.setState(stateIdle)
+	p.updateStatus()
+	p.showIdle()
+	return p.waitForSong(p.downloads.nextRetry())
+}
+
+// openSong opens the opus frames for a song. Songs are read from the cache,
+// while live streams are transcoded as they are played. The returned func
+// must be called when done with the song.
+func (p *player) openSong(song *songAndPath) (dca.OpusReader, func(), error) {
+	if song.Live {
+		streamURL := song.StreamURL
+		if streamURL == "" {
+			var err error
+			streamURL, err = p.yt.LiveStreamURL(song.VideoID)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		session, err := p.yt.EncodeLiveStream(streamURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return session, session.Cleanup, nil
 	}
-	if p.stream.Paused() {
-		p.dg.UpdateStatus(0, fmt.Sprintf("❚❚ %s", p.currentSong.Title))
+	var reader io.ReadCloser
+	var err error
+	if song.download != nil {
+		reader, err = newDownloadReader(song.fsPath, song.download)
 	} else {
-		p.dg.UpdateStatus(0, p.currentSong.Title)
+		reader, err = os.Open(filepath.FromSlash(song.fsPath))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return dca.NewDecoder(reader), func() { reader.Close() }, nil
+}
+
+// playSong streams a song to the voice channel, blocking until the song
+// finishes, is skipped or the player is shutdown.
+func (p *player) playSong(song *songAndPath) error {
+	source, closeSong, err := p.openSong(song)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"songpath": song.fsPath,
+			"stream":   song.StreamURL,
+			"error":    err,
+		}).Error("Failed to open song")
+		p.reportFailedSong(song.PlaylistEntry, err)
+		return err
+	}
+	var closeOnce sync.Once
+	defer closeOnce.Do(closeSong)
+	if !song.Live {
+		p.cache.touch(song.VideoID)
+	}
+	p.setNowPlayingMessage("", "")
+	p.stateLock.Lock()
+	p.pausedByUser = false
+	p.stateLock.Unlock()
+	p.vc.Speaking(true)
+
+	// Each stream gets its own done channel, so a stream that was skipped can
+	// never end the next song
+	streamDone := make(chan error, 1)
+	stream := dca.NewStream(source, p.vc, streamDone)
+	// Nothing can skip this song until it is the current song, so any skip
+	// left over is for a song that already ended
+	p.clearSkip()
+	p.setCurrent(song, stream)
+	p.setState(statePlaying)
+	p.updateStatus()
+	p.announceSong(song)
+	streamErr := p.waitForSongEnd(streamDone)
+	// No longer the current song, so it isn't protected from removal
+	p.setState(stateLoading)
+	p.songEnded(song)
+	closeOnce.Do(closeSong)
+	repeating := (streamErr == nil || streamErr == io.EOF) && p.isLooping()
+	if !song.Live && !repeating {
+		// A song about to repeat is kept, so it isn't downloaded again
+		p.cache.songFinished(song.VideoID)
+	}
+	outcome := historyOutcome(streamErr)
+	p.history.addSong(p.guildID, song.PlaylistEntry, outcome)
+	p.stats.recordPlay(song.PlaylistEntry, outcome, stream.PlaybackPosition())
+	if streamErr == errShutdown {
+		return streamErr
+	}
+	if streamErr != nil && streamErr != io.EOF && streamErr != errSkip {
+		// Handle the error
+		log.WithFields(log.Fields{
+			"error": streamErr,
+		}).Error("Error streaming song")
+		for !p.vc.Ready {
+			time.Sleep(time.Duration(2) * time.Second)
+		}
+	}
+	p.vc.Speaking(false)
+	return streamErr
+}
+
+func (p *player) updateStatus() {
+	song := p.playingSong()
+	switch p.getState() {
+	case statePlaying:
+		if song != nil {
+			p.dg.UpdateGameStatus(0, song.displayTitle())
+		}
+	case statePaused:
+		if song != nil {
+			p.dg.UpdateGameStatus(0, fmt.Sprintf("❚❚ %s", song.displayTitle()))
+		}
+	case stateIdle:
+		p.dg.UpdateGameStatus(0, "Waiting for requests")
+	case stateStopped:
+		p.dg.UpdateGameStatus(0, "Bot Stopped")
 	}
 }
 
 func (p *player) Pause() {
-	if p.stream != nil {
-		p.stream.SetPaused(true)
+	if stream := p.currentStream(); p.getState() == statePlaying && stream != nil {
+		stream.SetPaused(true)
+		p.setState(statePaused)
 		p.updateStatus()
 	}
 }
 
+// Play resumes a paused song, unless a user paused it.
 func (p *player) Play() {
-	if p.stream != nil {
-		p.stream.SetPaused(false)
+	if p.isPausedByUser() {
+		return
+	}
+	if stream := p.currentStream(); p.getState() == statePaused && stream != nil {
+		stream.SetPaused(false)
+		p.setState(statePlaying)
 		p.updateStatus()
 	}
 }
 
+// songAdded should be called after adding to the request queue, it starts
+// downloading the song and wakes the player if it is idle.
+func (p *player) songAdded() {
+	p.notifySongQueued()
+	go p.prefetchSongs()
+}
+
 func (p *player) Skip(numListeners int, requesterID string) string {
+	song := p.playingSong()
+	if song == nil {
+		return fmt.Sprintf("<@%s> - Nothing is playing right now.", requesterID)
+	}
 	if numListeners == 1 {
 		// Only one listener, let them skip
 		p.skipSong()
 		return fmt.Sprintf("<@%s> - Since you are all alone, skipping!", requesterID)
 	}
-	if !goutils.StringInSlice(requesterID, p.currentSong.skipsRequested) {
-		p.currentSong.skipsRequested = append(p.currentSong.skipsRequested, requesterID)
-	} else {
+	p.stateLock.Lock()
+	alreadyRequested := goutils.StringInSlice(requesterID, song.skipsRequested)
+	if !alreadyRequested {
+		song.skipsRequested = append(song.skipsRequested, requesterID)
+	}
+	numSkips := len(song.skipsRequested)
+	p.stateLock.Unlock()
+	if alreadyRequested {
 		// Already requested a skip on this song, can't requests again
 		return fmt.Sprintf("<@%s> - You already requested to skip this song, you can't again!", requesterID)
 	}
-	currentSkipRatio := float64(len(p.currentSong.skipsRequested)) / float64(numListeners)
+	currentSkipRatio := float64(numSkips) / float64(numListeners)
 	if currentSkipRatio >= p.conf.Bot.SkipRatio {
 		// Ratio is above required ratio, let skip the song
 		p.skipSong()
 		return fmt.Sprintf("<@%s> - Required ratio met, skipping song!", requesterID)
 	}
 
-	if len(p.currentSong.skipsRequested) >= p.conf.Bot.SkipsRequired {
+	if numSkips >= p.conf.Bot.SkipsRequired {
 		// Met total skips required, skip
 		p.skipSong()
 		return fmt.Sprintf("<@%s> - Met total required skips, skipping!", requesterID)
@@ -188,48 +398,345 @@ func (p *player) Skip(numListeners int, requesterID string) string {
 	return fmt.Sprintf("<@%s> - Your request to skip has been recorded, but not enough people have requested yet.", requesterID)
 }
 
+// rateCurrentSong records a users vote on the song currently playing, returning
+// the song that was rated, or nil if nothing is playing.
+func (p *player) rateCurrentSong(userID string, vote int) *PlaylistEntry {
+	song := p.nowPlaying()
+	if song == nil {
+		return nil
+	}
+	p.ratings.rate(userID, song, vote)
+	return song
+}
+
+// songIDs returns the id of the current song and every song waiting to be
+// played.
+func (p *player) songIDs() []string {
+	ids := p.playlist.videoIDs()
+	if song := p.nowPlaying(); song != nil && song.VideoID != "" {
+		ids = append(ids, song.VideoID)
+	}
+	return ids
+}
+
+// playbackPosition is how far into the current song the player is.
+func (p *player) playbackPosition() time.Duration {
+	stream := p.currentStream()
+	if stream == nil {
+		return 0
+	}
+	return stream.PlaybackPosition()
+}
+
+// timeLeft is how long until the current song finishes. Returns false if it
+// isn't known, such as for live streams.
+func (p *player) timeLeft() (time.Duration, bool) {
+	song := p.nowPlaying()
+	if song == nil {
+		return 0, true
+	}
+	if song.Live || song.Duration <= 0 {
+		return 0, false
+	}
+	left := song.length() - p.playbackPosition()
+	if left < 0 {
+		left = 0
+	}
+	return left, true
+}
+
+// nowPlaying returns the song currently playing or paused, or nil if there
+// isn't one.
+func (p *player) nowPlaying() *PlaylistEntry {
+	song := p.playingSong()
+	if song == nil {
+		return nil
+	}
+	return song.PlaylistEntry
+}
+
+// skipSong pauses the current song and ends it. The skip is kept until the
+// song is waited on, so it isn't lost while the song is being announced.
 func (p *player) skipSong() {
 	p.Pause()
-	p.streamDoneChan <- errSkip
+	select {
+	case p.skipChan <- struct{}{}:
+	default:
+		// A skip is already pending
+	}
 }
 
-func (p *player) downloadNextSong() {
-	p.downloadLock.Lock()
-	defer p.downloadLock.Unlock()
+// clearSkip forgets a pending skip.
+func (p *player) clearSkip() {
+	select {
+	case <-p.skipChan:
+	default:
+	}
+}
 
-	nextSong := p.playlist.peekNextSong()
-	if nextSong == nil {
-		log.Warn("Can't download next song, playlist is empty!")
+// waitForSongEnd blocks until the song finishes, is skipped or the player is
+// shutdown, returning why it ended.
+func (p *player) waitForSongEnd(streamDone <-chan error) error {
+	select {
+	case err := <-streamDone:
+		return err
+	case <-p.skipChan:
+		return errSkip
+	case <-p.shutdownChan:
+		return errShutdown
+	}
+}
+
+// prefetchSongs starts downloading the next songs, up to the prefetch depth, in
+// the background.
+func (p *player) prefetchSongs() {
+	upcoming := p.playlist.peekSongs(p.prefetchDepth())
+	if len(upcoming) == 0 {
+		if song := p.prefetchAutoplaySong(); song != nil {
+			upcoming = []PlaylistEntry{*song}
+		}
+	}
+	if len(upcoming) == 0 {
+		log.Debug("Nothing to prefetch, playlist is empty!")
 		return
 	}
+	for _, song := range upcoming {
+		if song.Live {
+			// Live streams are never downloaded
+			continue
+		}
+		p.downloads.queue(song.VideoID)
+	}
+}
+
+// waitForDownload blocks until a song is downloaded, or if prebuffer is more
+// than 0, until that much of the song has been downloaded so it can start
+// playing. If the download takes a while, and a user requested the song, a
+// message showing the download progress is posted and kept up to date.
+func (p *player) waitForDownload(song *PlaylistEntry, job *downloadJob, prebuffer time.Duration) error {
+	showProgress := p.conf.Bot.DownloadProgress && song.Requester != nil && song.RequestChannelID != ""
+	progressTicker := time.NewTicker(downloadProgressInterval)
+	defer progressTicker.Stop()
+	prebufferTicker := time.NewTicker(downloadReaderPollInterval)
+	defer prebufferTicker.Stop()
+	var progressMsg *discordgo.Message
+	defer func() {
+		if progressMsg != nil {
+			p.dg.ChannelMessageDelete(progressMsg.ChannelID, progressMsg.ID)
+		}
+	}()
+	for {
+		select {
+		case <-job.done:
+			return job.err
+		case <-prebufferTicker.C:
+			if encoded, _ := job.progress(); prebuffer > 0 && encoded >= prebuffer {
+				return nil
+			}
+		case <-progressTicker.C:
+			if !showProgress {
+				continue
+			}
+			encoded, total := job.progress()
+			message := fmt.Sprintf("<@%s> - Downloading **%s**...", song.Requester.ID, song.Title)
+			if total > 0 {
+				message = fmt.Sprintf("%s %d%% (%s of %s)", message, int(100*encoded/total),
+					encoded.Round(time.Second), total.Round(time.Second))
+			}
+			var err error
+			if progressMsg == nil {
+				progressMsg, err = p.dg.ChannelMessageSend(song.RequestChannelID, message)
+			} else {
+				_, err = p.dg.ChannelMessageEdit(progressMsg.ChannelID, progressMsg.ID, message)
+			}
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Error("Failed to send download progress message")
+			}
+		}
+	}
+}
 
-	songFilePath := path.Join(p.yt.YTCacheDir, nextSong.VideoID+".dca")
-	if _, err := os.Stat(filepath.FromSlash(songFilePath)); os.IsNotExist(err) {
+// streamPrebuffer is how much of a song must be downloaded before it can start
+// playing, 0 if songs must be completely downloaded first.
+func (p *player) streamPrebuffer() time.Duration {
+	if !p.conf.Bot.StreamWhileDownloading {
+		return 0
+	}
+	if p.conf.Bot.StreamPrebuffer < 1 {
+		return time.Second
+	}
+	return time.Duration(p.conf.Bot.StreamPrebuffer) * time.Second
+}
+
+// reportFailedSong records a song that couldn't be played in the history, and
+// lets the user who requested it know.
+func (p *player) reportFailedSong(song *PlaylistEntry, reason error) {
+	p.history.addSong(p.guildID, song, historyFailed)
+	p.notifyFailedSong(song, reason)
+}
+
+// notifyFailedSong lets the user who requested a song know it couldn't be
+// played.
+func (p *player) notifyFailedSong(song *PlaylistEntry, reason error) {
+	if song.Requester == nil || song.RequestChannelID == "" {
+		return
+	}
+	message := errorMessage(song.Requester.ID, fmt.Sprintf("Sorry, your song **%s** couldn't be played: %s", song.Title, reason))
+	msg, err := sendMessage(p.dg, p.conf.Bot.UseEmbeds, song.RequestChannelID, message)
+	if err != nil {
 		log.WithFields(log.Fields{
-			"song": filepath.FromSlash(songFilePath),
-		}).Debug("Downloading song")
-		_, dlErr := p.yt.DownloadDCAAudio(nextSong.VideoID)
-		if dlErr != nil {
-			log.WithFields(log.Fields{
-				"song": nextSong.VideoID,
-			}).Error(dlErr)
+			"msg":   msg,
+			"error": err,
+		}).Error("Failed to send message about failed request")
+		return
+	}
+	if p.conf.Bot.DeleteMessages {
+		p.deletions.schedule(msg.ChannelID, msg.ID, time.Duration(p.conf.Bot.DeleteMessagesDelay)*time.Second)
+	}
+}
+
+func (p *player) prefetchDepth() int {
+	if p.conf.Bot.PrefetchDepth < 1 {
+		return 1
+	}
+	return p.conf.Bot.PrefetchDepth
+}
+
+// prefetchAutoplaySong picks the song to autoplay after the last song played,
+// so it can be downloaded before it is needed. The pick is kept apart from the
+// request queue, so anything requested in the meantime plays before it.
+func (p *player) prefetchAutoplaySong() *PlaylistEntry {
+	p.autoplayLock.Lock()
+	defer p.autoplayLock.Unlock()
+	return p.autoplaySongLocked()
+}
+
+// takeAutoplaySong returns the song to autoplay now that nothing is queued,
+// or nil if there isn't one.
+func (p *player) takeAutoplaySong() *PlaylistEntry {
+	p.autoplayLock.Lock()
+	defer p.autoplayLock.Unlock()
+	song := p.autoplaySongLocked()
+	p.autoplayNext = nil
+	return song
+}
+
+// autoplaySongLocked returns the song picked to autoplay after the last song
+// played, picking one if it hasn't been yet. Must be called with autoplayLock
+// held.
+func (p *player) autoplaySongLocked() *PlaylistEntry {
+	videoID, title := p.lastSong()
+	if p.autoplayNext == nil || p.autoplaySeed != videoID {
+		p.autoplayNext = p.relatedSong(videoID, title)
+		p.autoplaySeed = videoID
+	}
+	return p.autoplayNext
+}
+
+// relatedSong finds a video related to a song, when radio mode is enabled.
+// Videos heard recently, live streams and videos longer than the configured
+// max length are ignored. Returns nil if there isn't a suitable video.
+func (p *player) relatedSong(lastVideoID string, lastTitle string) *PlaylistEntry {
+	if !p.conf.Bot.AutoplayRelated || lastVideoID == "" {
+		return nil
+	}
+	related, err := p.yt.RelatedVideos(lastVideoID, lastTitle)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"song":  lastVideoID,
+			"error": err,
+		}).Error("Failed to find related videos to autoplay")
+		return nil
+	}
+	var candidates []youtube.SearchResult
+	var candidateIDs []string
+	for _, result := range related.Items {
+		videoID := result.ID.VideoID
+		if videoID == "" || videoID == lastVideoID {
+			continue
 		}
-	} else {
+		if result.Snippet.LiveBroadcastContent != "" && result.Snippet.LiveBroadcastContent != "none" {
+			continue
+		}
+		if p.history.playedRecently(videoID, p.conf.Bot.PlaylistNoRepeat) {
+			continue
+		}
+		candidates = append(candidates, result)
+		candidateIDs = append(candidateIDs, videoID)
+	}
+	maxLength := time.Duration(p.conf.Bot.AutoplayMaxLength) * time.Second
+	details, err := p.yt.VideoDetails(candidateIDs)
+	if err != nil {
+		// Keyless search backends include the durations, such as when there
+		// is no api key
 		log.WithFields(log.Fields{
-			"song": filepath.FromSlash(songFilePath),
-		}).Debug("Song already downloaded")
+			"error": err,
+		}).Debug("Failed to look up related video details")
 	}
+	for _, candidate := range candidates {
+		videoDetails, ok := details[candidate.ID.VideoID]
+		if !ok && err == nil {
+			// The video couldn't be found
+			continue
+		}
+		if !ok {
+			videoDetails.Duration = candidate.Duration
+		}
+		if maxLength > 0 && (videoDetails.Duration <= 0 || videoDetails.Duration > maxLength) {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"song":  candidate.ID.VideoID,
+			"title": candidate.Snippet.Title,
+		}).Info("Autoplaying related song")
+		entry := PlaylistEntry{Title: candidate.Snippet.Title, VideoID: candidate.ID.VideoID, Autoplayed: true}
+		entry.setDetails(videoDetails)
+		return &entry
+	}
+	log.WithFields(log.Fields{
+		"song": lastVideoID,
+	}).Warn("No suitable related songs to autoplay")
+	return nil
 }
 
 func (p *player) getNextSongPath() (*songAndPath, error) {
 	nextSong := p.playlist.nextSong()
 	if nextSong == nil {
-		log.Warn("Can't get next song path, playlist is empty!")
+		log.Debug("Can't get next song path, playlist is empty!")
+		return nil, errPlaylistEmpty
 	}
+	return p.songPath(nextSong)
+}
 
-	songFilePath := path.Join(p.yt.YTCacheDir, nextSong.VideoID+".dca")
+// songPath finds where a song will be played from, downloading it if it isn't
+// in the cache.
+func (p *player) songPath(nextSong *PlaylistEntry) (*songAndPath, error) {
+	if nextSong.Live {
+		return &songAndPath{skipsRequested: []string{}, PlaylistEntry: nextSong}, nil
+	}
+
+	job := p.downloads.queue(nextSong.VideoID)
+	// A song that recently failed was already recorded in the history
+	alreadyFailed := job.finished() && job.err != nil
+	err := p.waitForDownload(nextSong, job, p.streamPrebuffer())
+	if err != nil {
+		if alreadyFailed {
+			p.notifyFailedSong(nextSong, err)
+		} else {
+			p.reportFailedSong(nextSong, err)
+		}
+		return nil, err
+	}
+
+	songFilePath := p.yt.DCAPath(nextSong.VideoID)
+	if !job.finished() {
+		// Start playing while the rest of the song downloads
+		return &songAndPath{fsPath: songFilePath, skipsRequested: []string{}, download: job, PlaylistEntry: nextSong}, nil
+	}
 	if _, err := os.Stat(filepath.FromSlash(songFilePath)); err == nil {
-		return &songAndPath{songFilePath, []string{}, nextSong}, nil
+		return &songAndPath{fsPath: songFilePath, skipsRequested: []string{}, PlaylistEntry: nextSong}, nil
 	}
 	log.WithFields(log.Fields{
 		"songpath": songFilePath,
@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 
 	"github.com/jatgam/goutils"
 	"github.com/jatgam/goutils/log"
+
+	"github.com/shawnsilva/piccolo/youtube"
 )
 
 type (
@@ -17,16 +22,31 @@ type (
 	PlaylistEntry struct {
 		Requester        *discordgo.User `json:"-"`
 		RequestChannelID string          `json:"-"`
+		Autoplayed       bool            `json:"-"`
 		Title            string          `json:"title"`
 		VideoID          string          `json:"videoID"`
+		Live             bool            `json:"live,omitempty"`
+		StreamURL        string          `json:"streamURL,omitempty"`
+		// Duration is the length of the song in seconds, 0 if unknown
+		Duration  int    `json:"duration,omitempty"`
+		Channel   string `json:"channel,omitempty"`
+		Thumbnail string `json:"thumbnail,omitempty"`
 	}
 
 	playlist struct {
-		requestQueue *goutils.Queue
-		list         *goutils.DoubleLinkedList
-		current      *goutils.Node
-		usePlaylist  bool
-		playlistPath string
+		requestQueue     *goutils.Queue
+		list             *goutils.DoubleLinkedList
+		current          *goutils.Node
+		usePlaylist      bool
+		playlistPath     string
+		history          *history
+		noRepeat         int
+		ratings          *ratings
+		dislikeThreshold int
+		// unavailable checks if a video can't be played right now, such as
+		// when it recently failed to download, nil if every video can be
+		unavailable func(videoID string) bool
+		lock        *sync.Mutex
 	}
 
 	// PlaylistJSON is used to handled marshalling and unmarshalling a playlist
@@ -36,35 +56,82 @@ type (
 	}
 )
 
-func newPlaylist(usePlaylist bool, playlistPath string) *playlist {
+// displayTitle is the title of the song, marked if it is a live stream.
+func (e PlaylistEntry) displayTitle() string {
+	if e.Live {
+		return "🔴 LIVE " + e.Title
+	}
+	return e.Title
+}
+
+// length is how long the song is, 0 if it isn't known.
+func (e PlaylistEntry) length() time.Duration {
+	return time.Duration(e.Duration) * time.Second
+}
+
+// displayLength is the length of the song for showing in the queue.
+func (e PlaylistEntry) displayLength() string {
+	if e.Live {
+		return "LIVE"
+	}
+	if e.Duration <= 0 {
+		return "?:??"
+	}
+	return formatDuration(e.length())
+}
+
+// setDetails fills in the details looked up for the songs video.
+func (e *PlaylistEntry) setDetails(details youtube.VideoDetails) {
+	e.Duration = int(details.Duration / time.Second)
+	if details.ChannelTitle != "" {
+		e.Channel = details.ChannelTitle
+	}
+	if details.ThumbnailURL != "" {
+		e.Thumbnail = details.ThumbnailURL
+	}
+}
+
+// formatDuration shows a duration like a media player would, e.g. 3:05 or
+// 1:02:03.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	hours := int(d / time.Hour)
+	minutes := int(d/time.Minute) % 60
+	seconds := int(d/time.Second) % 60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
+
+// id uniquely identifies a song, it is the video id for youtube videos and the
+// stream url for anything else.
+func (e PlaylistEntry) id() string {
+	if e.VideoID == "" {
+		return e.StreamURL
+	}
+	return e.VideoID
+}
+
+func newPlaylist(usePlaylist bool, playlistPath string, h *history, noRepeat int, r *ratings, dislikeThreshold int) *playlist {
 	p := &playlist{requestQueue: goutils.NewQueue(), list: goutils.NewDoubleLinkedList(),
-		usePlaylist: usePlaylist, playlistPath: playlistPath}
+		usePlaylist: usePlaylist, playlistPath: playlistPath, history: h, noRepeat: noRepeat,
+		ratings: r, dislikeThreshold: dislikeThreshold, lock: &sync.Mutex{}}
 	p.loadPlaylist()
 	p.current = p.list.First()
 	return p
 }
 
 func (p *playlist) loadPlaylist() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	if p.usePlaylist {
-		playlistFileContents, err := ioutil.ReadFile(filepath.FromSlash(p.playlistPath))
+		filePlaylist, err := ReadPlaylistFile(p.playlistPath)
 		if err != nil {
-			log.WithFields(log.Fields{
-				"file":  filepath.FromSlash(p.playlistPath),
-				"error": err,
-			}).Error("Failed to open playlist file to read")
-			return fmt.Errorf("Couldn't read the playlist file")
-		}
-		var filePlaylist = PlaylistJSON{}
-		jsonErr := json.Unmarshal(playlistFileContents, &filePlaylist)
-		if jsonErr != nil {
-			log.WithFields(log.Fields{
-				"file":  filepath.FromSlash(p.playlistPath),
-				"error": err,
-			}).Error("Failed to decode playlist json")
-			return fmt.Errorf("Couldn't decode the playlist file")
+			return err
 		}
 		for _, entry := range filePlaylist.Entries {
-			p.list.InsertEnd(goutils.NewNode(entry.VideoID, entry))
+			p.list.InsertEnd(goutils.NewNode(entry.id(), entry))
 		}
 	} else {
 		log.Debug("Attempted to load a playlist when use is disabled in config file.")
@@ -74,7 +141,31 @@ func (p *playlist) loadPlaylist() error {
 	return nil
 }
 
+// ReadPlaylistFile reads and decodes a playlist json file.
+func ReadPlaylistFile(playlistPath string) (PlaylistJSON, error) {
+	var filePlaylist = PlaylistJSON{}
+	playlistFileContents, err := ioutil.ReadFile(filepath.FromSlash(playlistPath))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(playlistPath),
+			"error": err,
+		}).Error("Failed to open playlist file to read")
+		return filePlaylist, fmt.Errorf("Couldn't read the playlist file")
+	}
+	jsonErr := json.Unmarshal(playlistFileContents, &filePlaylist)
+	if jsonErr != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(playlistPath),
+			"error": jsonErr,
+		}).Error("Failed to decode playlist json")
+		return filePlaylist, fmt.Errorf("Couldn't decode the playlist file")
+	}
+	return filePlaylist, nil
+}
+
 func (p *playlist) savePlaylist() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	if p.usePlaylist {
 		currentPlaylist := &PlaylistJSON{Entries: []PlaylistEntry{}}
 		currentNode := p.list.First()
@@ -105,75 +196,82 @@ func (p *playlist) savePlaylist() error {
 	return nil
 }
 
-func (p *playlist) String() string {
-	var queueString string
-	var playlistString string
-	queueItem := p.requestQueue.First()
-	count := 1
-	if queueItem == nil {
-		queueString = "\tEmpty"
-	} else {
-		for {
-			if queueItem == nil {
-				break
-			}
-			song, ok := queueItem.Data().(PlaylistEntry)
-			if !ok {
-				continue
-			}
-			queueString = queueString + fmt.Sprintf("\t%d. %s - Requester: %s\n",
-				count, song.Title, song.Requester.Username)
-			queueItem = queueItem.Next()
-			count++
-		}
+// addEntry queues a song that has already been looked up on behalf of the
+// requester.
+func (p *playlist) addEntry(requester *discordgo.User, channelID string, entry PlaylistEntry) {
+	entry.Requester = requester
+	entry.RequestChannelID = channelID
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.requestQueue.Push(entry)
+}
+
+// passOver checks if the auto playlist should avoid playing a song, because it
+// was heard within the last noRepeat plays or has been heavily disliked. Must
+// be called with lock held.
+func (p *playlist) passOver(song PlaylistEntry) bool {
+	if p.history != nil && p.history.playedRecently(song.id(), p.noRepeat) {
+		return true
 	}
-	count = 1
-	if p.usePlaylist {
-		currentNode := p.list.First()
-		for {
-			if currentNode == nil {
-				break
-			}
-			_, value := currentNode.GetData()
-			if song, ok := value.(PlaylistEntry); ok {
-				playlistString = playlistString + fmt.Sprintf("\t%d. %s\n",
-					count, song.Title)
-				count++
-			}
-			currentNode = currentNode.Next()
-		}
-	} else {
-		playlistString = "\tDisabled"
+	if p.ratings != nil && p.ratings.disliked(song.id(), p.dislikeThreshold) {
+		return true
 	}
+	return false
+}
 
-	return fmt.Sprintf("**Request Queue:**\n```%s```\n**Playlist:**\n```%s```",
-		queueString, playlistString)
+// isUnavailable checks if a song can't be played right now. Must be called
+// with lock held.
+func (p *playlist) isUnavailable(song PlaylistEntry) bool {
+	return p.unavailable != nil && !song.Live && song.VideoID != "" && p.unavailable(song.VideoID)
 }
 
-func (p *playlist) addSong(requester *discordgo.User, channelID string, id string, title string) {
-	p.requestQueue.Push(PlaylistEntry{
-		Requester:        requester,
-		RequestChannelID: channelID,
-		Title:            title,
-		VideoID:          id,
-	})
+// nextPlaylistNode finds the node the auto playlist should play next, starting
+// from the current position. Songs that should be passed over are skipped,
+// unless every song in the playlist should be. Songs that are unavailable are
+// always skipped, nil is returned if every song is. Must be called with lock
+// held.
+func (p *playlist) nextPlaylistNode() *goutils.Node {
+	start := p.current
+	if start == nil {
+		start = p.list.First()
+	}
+	if start == nil {
+		return nil
+	}
+	var fallback *goutils.Node
+	node := start
+	for i := 0; i < p.list.Length(); i++ {
+		_, songData := node.GetData()
+		if song, ok := songData.(PlaylistEntry); ok && !p.isUnavailable(song) {
+			if !p.passOver(song) {
+				return node
+			}
+			if fallback == nil {
+				fallback = node
+			}
+		}
+		node = node.Next()
+		if node == nil {
+			node = p.list.First()
+		}
+	}
+	return fallback
 }
 
 func (p *playlist) nextSong() *PlaylistEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	for {
 		if p.requestQueue.Length() <= 0 {
 			if p.list.Length() <= 0 {
 				break
 			} else {
-				if p.current == nil {
-					if p.list.First() != nil {
-						p.current = p.list.First()
-					} else {
-						break
-					}
+				node := p.nextPlaylistNode()
+				if node == nil {
+					break
 				}
-				_, songData := p.current.GetData()
-				p.current = p.current.Next()
+				_, songData := node.GetData()
+				p.current = node.Next()
 				song, ok := songData.(PlaylistEntry)
 				if !ok {
 					continue
@@ -191,22 +289,21 @@ func (p *playlist) nextSong() *PlaylistEntry {
 }
 
 func (p *playlist) peekNextSong() *PlaylistEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	for {
 		if p.requestQueue.Length() <= 0 {
 			if p.list.Length() <= 0 {
 				break
 			} else {
-				if p.current == nil {
-					if p.list.First() != nil {
-						p.current = p.list.First()
-					} else {
-						break
-					}
+				node := p.nextPlaylistNode()
+				if node == nil {
+					break
 				}
-				_, songData := p.current.GetData()
+				_, songData := node.GetData()
 				song, ok := songData.(PlaylistEntry)
 				if !ok {
-					continue
+					break
 				}
 				return &song
 			}
@@ -219,3 +316,141 @@ func (p *playlist) peekNextSong() *PlaylistEntry {
 	}
 	return nil
 }
+
+// upcoming returns every song waiting to be played, in the order they should
+// play.
+func (p *playlist) upcoming() []PlaylistEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.peekSongsLocked(p.requestQueue.Length() + p.list.Length())
+}
+
+// hasRequests checks if any songs are in the request queue.
+func (p *playlist) hasRequests() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.requestQueue.Length() > 0
+}
+
+// peekSongs returns up to num of the songs that will play next, without
+// removing them. Requests come first, followed by the auto playlist.
+func (p *playlist) peekSongs(num int) []PlaylistEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.peekSongsLocked(num)
+}
+
+// peekSongsLocked is peekSongs, it must be called with lock held.
+func (p *playlist) peekSongsLocked(num int) []PlaylistEntry {
+	var songs []PlaylistEntry
+	for queueItem := p.requestQueue.First(); queueItem != nil && len(songs) < num; queueItem = queueItem.Next() {
+		if song, ok := queueItem.Data().(PlaylistEntry); ok {
+			songs = append(songs, song)
+		}
+	}
+	node := p.nextPlaylistNode()
+	for i := 0; node != nil && i < p.list.Length() && len(songs) < num; i++ {
+		_, songData := node.GetData()
+		// The first node has already been checked by nextPlaylistNode
+		if song, ok := songData.(PlaylistEntry); ok && (i == 0 || !p.passOver(song)) && !p.isUnavailable(song) {
+			songs = append(songs, song)
+		}
+		node = node.Next()
+		if node == nil {
+			node = p.list.First()
+		}
+	}
+	return songs
+}
+
+// videoIDs returns the video id of every youtube video in the request queue
+// and playlist.
+func (p *playlist) videoIDs() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var ids []string
+	for queueItem := p.requestQueue.First(); queueItem != nil; queueItem = queueItem.Next() {
+		if song, ok := queueItem.Data().(PlaylistEntry); ok && song.VideoID != "" {
+			ids = append(ids, song.VideoID)
+		}
+	}
+	for node := p.list.First(); node != nil; node = node.Next() {
+		_, songData := node.GetData()
+		if song, ok := songData.(PlaylistEntry); ok && song.VideoID != "" {
+			ids = append(ids, song.VideoID)
+		}
+	}
+	return ids
+}
+
+// missingDetails returns the video ids of playlist songs that don't have their
+// details filled in yet.
+func (p *playlist) missingDetails() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var ids []string
+	for node := p.list.First(); node != nil; node = node.Next() {
+		_, songData := node.GetData()
+		if song, ok := songData.(PlaylistEntry); ok && song.VideoID != "" && !song.Live && song.Duration == 0 {
+			ids = append(ids, song.VideoID)
+		}
+	}
+	return ids
+}
+
+// setDetails fills in the details of playlist songs, returning how many songs
+// were updated.
+func (p *playlist) setDetails(details map[string]youtube.VideoDetails) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	updated := 0
+	for node := p.list.First(); node != nil; node = node.Next() {
+		name, songData := node.GetData()
+		song, ok := songData.(PlaylistEntry)
+		if !ok {
+			continue
+		}
+		if songDetails, ok := details[song.VideoID]; ok {
+			song.setDetails(songDetails)
+			node.SetData(name, song)
+			updated++
+		}
+	}
+	return updated
+}
+
+// shuffleRequests puts the request queue in a random order, returning how
+// many songs were shuffled. The auto playlist is left in its order.
+func (p *playlist) shuffleRequests() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	songs := p.popRequests()
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	random.Shuffle(len(songs), func(i, j int) {
+		songs[i], songs[j] = songs[j], songs[i]
+	})
+	for _, song := range songs {
+		p.requestQueue.Push(song)
+	}
+	return len(songs)
+}
+
+// clearRequestQueue removes every song from the request queue, returning the
+// songs that were removed.
+func (p *playlist) clearRequestQueue() []PlaylistEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.popRequests()
+}
+
+// popRequests removes and returns every song in the request queue. Must be
+// called with lock held.
+func (p *playlist) popRequests() []PlaylistEntry {
+	var songs []PlaylistEntry
+	for p.requestQueue.Length() > 0 {
+		if song, ok := p.requestQueue.Pop().(PlaylistEntry); ok {
+			songs = append(songs, song)
+		}
+	}
+	return songs
+}
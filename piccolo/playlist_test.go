@@ -0,0 +1,52 @@
+package piccolo
+
+import (
+	"testing"
+
+	"github.com/jatgam/goutils"
+)
+
+func newTestPlaylist(videoIDs ...string) *playlist {
+	p := newPlaylist(false, "", nil, 0, nil, 0)
+	for _, videoID := range videoIDs {
+		entry := PlaylistEntry{Title: videoID, VideoID: videoID}
+		p.list.InsertEnd(goutils.NewNode(entry.id(), entry))
+	}
+	p.current = p.list.First()
+	return p
+}
+
+func TestNextSongSkipsUnavailable(t *testing.T) {
+	p := newTestPlaylist("a", "b", "c")
+	p.unavailable = func(videoID string) bool { return videoID == "b" }
+	var played []string
+	for i := 0; i < 4; i++ {
+		song := p.nextSong()
+		if song == nil {
+			t.Fatal("nextSong returned nothing")
+		}
+		played = append(played, song.VideoID)
+	}
+	want := []string{"a", "c", "a", "c"}
+	for i := range want {
+		if played[i] != want[i] {
+			t.Fatalf("Played %v, want %v", played, want)
+		}
+	}
+}
+
+func TestNextSongEveryoneUnavailable(t *testing.T) {
+	p := newTestPlaylist("a", "b")
+	p.unavailable = func(videoID string) bool { return true }
+	if song := p.nextSong(); song != nil {
+		t.Errorf("nextSong returned %s when every song is unavailable", song.VideoID)
+	}
+	if song := p.peekNextSong(); song != nil {
+		t.Errorf("peekNextSong returned %s when every song is unavailable", song.VideoID)
+	}
+	// Requests are still played, the requester is told if they fail
+	p.addEntry(nil, "", PlaylistEntry{Title: "r", VideoID: "r"})
+	if song := p.nextSong(); song == nil || song.VideoID != "r" {
+		t.Errorf("nextSong didn't return the request")
+	}
+}
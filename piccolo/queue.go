@@ -0,0 +1,162 @@
+package piccolo
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/jatgam/goutils/log"
+)
+
+const (
+	queuePageSize      = 10
+	queueTitleLength   = 60
+	queuePrevPageEmoji = "⏪"
+	queueNextPageEmoji = "⏩"
+	// queueViewTTL is how long the page of a queue message can be changed
+	queueViewTTL = 10 * time.Minute
+)
+
+type (
+	// queueView is a queue message that can be paged through with reactions.
+	queueView struct {
+		channelID string
+		userID    string
+		page      int
+		gControl  *guildControls
+		createdAt time.Time
+	}
+
+	// queueViews tracks every queue message that can still be paged.
+	queueViews struct {
+		views map[string]*queueView
+		lock  *sync.Mutex
+	}
+)
+
+func newQueueViews() *queueViews {
+	return &queueViews{views: make(map[string]*queueView), lock: &sync.Mutex{}}
+}
+
+func (q *queueViews) add(messageID string, view *queueView) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for id, old := range q.views {
+		if time.Since(old.createdAt) > queueViewTTL {
+			delete(q.views, id)
+		}
+	}
+	q.views[messageID] = view
+}
+
+func (q *queueViews) get(messageID string) (*queueView, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	view, ok := q.views[messageID]
+	if !ok || time.Since(view.createdAt) > queueViewTTL {
+		return nil, false
+	}
+	return view, true
+}
+
+// truncateTitle shortens long titles so a list of songs, such as a page of
+// the queue, fits in one message.
+func truncateTitle(title string) string {
+	runes := []rune(title)
+	if len(runes) <= queueTitleLength {
+		return title
+	}
+	return string(runes[:queueTitleLength-3]) + "..."
+}
+
+// queueMessage renders one page of the songs waiting to play, with when each
+// should start. page starts at 1 and is clamped to the pages available, the
+// page shown is returned along with the number of pages.
+func queueMessage(p *player, userID string, page int) (botMessage, int, int) {
+	upcoming := p.playlist.upcoming()
+	pages := (len(upcoming) + queuePageSize - 1) / queuePageSize
+	if pages < 1 {
+		pages = 1
+	}
+	if page > pages {
+		page = pages
+	}
+	if page < 1 {
+		page = 1
+	}
+	eta, etaKnown := p.timeLeft()
+	var total time.Duration
+	var lines []string
+	for i, song := range upcoming {
+		etaString := "?"
+		if etaKnown {
+			etaString = formatDuration(eta)
+		}
+		if i >= (page-1)*queuePageSize && i < page*queuePageSize {
+			requester := "Playlist"
+			if song.Requester != nil {
+				requester = song.Requester.Username
+			} else if song.Autoplayed {
+				requester = "Autoplay"
+			}
+			lines = append(lines, fmt.Sprintf("%d. %s [%s] - %s - in %s", i+1, truncateTitle(song.Title),
+				song.displayLength(), requester, etaString))
+		}
+		if song.Live || song.Duration <= 0 {
+			// Can't know when anything after this will play
+			etaKnown = false
+		}
+		eta += song.length()
+		total += song.length()
+	}
+	listing := "Empty"
+	if len(lines) > 0 {
+		listing = strings.Join(lines, "\n")
+	}
+	summary := fmt.Sprintf("Page %d of %d, %d songs, %s total", page, pages, len(upcoming), formatDuration(total))
+	msg := botMessage{
+		kind:        messageQueue,
+		mentionID:   userID,
+		title:       "Queue",
+		description: fmt.Sprintf("```%s```", listing),
+		footer:      summary,
+		text:        fmt.Sprintf("<@%s> - **Queue** (%s)\n```%s```", userID, summary, listing),
+	}
+	return msg, page, pages
+}
+
+// queueReaction changes the page of a queue message when one of the paging
+// reactions is added to it. Returns true if the message was a queue message.
+func (b *Bot) queueReaction(s *discordgo.Session, r *discordgo.MessageReactionAdd) bool {
+	view, ok := b.queueViews.get(r.MessageID)
+	if !ok {
+		return false
+	}
+	page := view.page
+	switch r.Emoji.Name {
+	case queuePrevPageEmoji:
+		page--
+	case queueNextPageEmoji:
+		page++
+	default:
+		return true
+	}
+	// Remove the reaction so it can be pressed again
+	s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.Name, r.UserID)
+	msg, page, _ := queueMessage(view.gControl.player, view.userID, page)
+	if page == view.page {
+		return true
+	}
+	view.page = page
+	_, err := editMessage(s, b.conf.Bot.UseEmbeds, view.channelID, r.MessageID, msg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"message": r.MessageID,
+			"error":   err,
+		}).Error("Failed to change queue page")
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package piccolo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/jatgam/goutils/log"
+)
+
+const (
+	likeEmoji    = "👍"
+	dislikeEmoji = "👎"
+
+	voteLike    = 1
+	voteDislike = -1
+)
+
+type (
+	// SongRating stores each listeners vote on a song, keyed by user id
+	SongRating struct {
+		Title string         `json:"title"`
+		Votes map[string]int `json:"votes"`
+	}
+
+	// RatingsJSON is used to handle marshalling and unmarshalling song ratings
+	// to a file on disk
+	RatingsJSON struct {
+		Songs map[string]*SongRating `json:"songs"`
+	}
+
+	ratings struct {
+		songs       map[string]*SongRating
+		ratingsPath string
+		lock        *sync.Mutex
+	}
+)
+
+func newRatings(ratingsPath string) *ratings {
+	r := &ratings{songs: make(map[string]*SongRating), ratingsPath: ratingsPath, lock: &sync.Mutex{}}
+	r.loadRatings()
+	return r
+}
+
+func (r *ratings) loadRatings() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ratingsFileContents, err := ioutil.ReadFile(filepath.FromSlash(r.ratingsPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(r.ratingsPath),
+			"error": err,
+		}).Error("Failed to open ratings file to read")
+		return fmt.Errorf("Couldn't read the ratings file")
+	}
+	var fileRatings = RatingsJSON{}
+	jsonErr := json.Unmarshal(ratingsFileContents, &fileRatings)
+	if jsonErr != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(r.ratingsPath),
+			"error": jsonErr,
+		}).Error("Failed to decode ratings json")
+		return fmt.Errorf("Couldn't decode the ratings file")
+	}
+	for videoID, rating := range fileRatings.Songs {
+		if rating.Votes == nil {
+			rating.Votes = make(map[string]int)
+		}
+		r.songs[videoID] = rating
+	}
+	log.Debug("Loaded ratings")
+	return nil
+}
+
+// saveRatings must be called with the ratings lock held.
+func (r *ratings) saveRatings() error {
+	ratingsDir := filepath.FromSlash(path.Dir(r.ratingsPath))
+	if _, err := os.Stat(ratingsDir); os.IsNotExist(err) {
+		err := os.MkdirAll(ratingsDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	jsonRatings, _ := json.MarshalIndent(&RatingsJSON{Songs: r.songs}, "", "    ")
+	err := ioutil.WriteFile(filepath.FromSlash(r.ratingsPath), jsonRatings, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(r.ratingsPath),
+			"error": err,
+		}).Error("Failed to write ratings json file")
+		return fmt.Errorf("Error saving ratings file")
+	}
+	return nil
+}
+
+// rate records a users vote on a song, replacing any vote they made before.
+func (r *ratings) rate(userID string, song *PlaylistEntry, vote int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.songs[song.id()]; !ok {
+		r.songs[song.id()] = &SongRating{Votes: make(map[string]int)}
+	}
+	r.songs[song.id()].Title = song.Title
+	r.songs[song.id()].Votes[userID] = vote
+	r.saveRatings()
+}
+
+func (r *ratings) score(videoID string) (likes int, dislikes int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rating, ok := r.songs[videoID]
+	if !ok {
+		return 0, 0
+	}
+	for _, vote := range rating.Votes {
+		if vote > 0 {
+			likes++
+		} else if vote < 0 {
+			dislikes++
+		}
+	}
+	return likes, dislikes
+}
+
+// disliked checks if a song has at least threshold more dislikes than likes.
+// A threshold of 0 or less disables the check.
+func (r *ratings) disliked(videoID string, threshold int) bool {
+	if threshold <= 0 {
+		return false
+	}
+	likes, dislikes := r.score(videoID)
+	return dislikes-likes >= threshold
+}
@@ -0,0 +1,196 @@
+package piccolo
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/jatgam/goutils/log"
+)
+
+type messageKind int
+
+const (
+	messageInfo messageKind = iota
+	messageNowPlaying
+	messageEnqueued
+	messageQueue
+	messageError
+)
+
+// maxEmbedDescription is the most characters discord allows in an embed
+// description.
+const maxEmbedDescription = 2048
+
+const (
+	codeFence       = "```"
+	closeCodeFence  = "\n" + codeFence
+	truncatedSuffix = "..."
+)
+
+var messageColors = map[messageKind]int{
+	messageInfo:       0x7289da,
+	messageNowPlaying: 0x1db954,
+	messageEnqueued:   0x3498db,
+	messageQueue:      0x9b59b6,
+	messageError:      0xe74c3c,
+}
+
+type (
+	// botMessage is a message the bot sends, rendered as an embed or as plain
+	// text when embeds are disabled.
+	botMessage struct {
+		kind messageKind
+		// mentionID is the user the message is for, they are mentioned
+		// outside of the embed so they still get notified
+		mentionID   string
+		title       string
+		description string
+		fields      []*discordgo.MessageEmbedField
+		thumbnail   string
+		footer      string
+		// components are buttons shown under the message, in both forms
+		components []discordgo.MessageComponent
+		// text is the whole message as plain text
+		text string
+	}
+)
+
+func (msg botMessage) embed() *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       msg.title,
+		Description: truncateDescription(msg.description),
+		Color:       messageColors[msg.kind],
+		Fields:      msg.fields,
+	}
+	if msg.thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: msg.thumbnail}
+	}
+	if msg.footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: msg.footer}
+	}
+	return embed
+}
+
+// truncateDescription shortens a description discord would reject as too
+// long. It is cut by characters rather than bytes so a multi byte character is
+// never split, and a code block left open by the cut is closed.
+func truncateDescription(description string) string {
+	runes := []rune(description)
+	if len(runes) <= maxEmbedDescription {
+		return description
+	}
+	cut := maxEmbedDescription - len(truncatedSuffix)
+	truncated := string(runes[:cut])
+	if strings.Count(truncated, codeFence)%2 == 1 {
+		// Make room to close the code block, which may cut off its opening
+		truncated = string(runes[:cut-len(closeCodeFence)])
+		if strings.Count(truncated, codeFence)%2 == 1 {
+			truncated += closeCodeFence
+		}
+	}
+	return truncated + truncatedSuffix
+}
+
+func (msg botMessage) mention() string {
+	if msg.mentionID == "" {
+		return ""
+	}
+	return "<@" + msg.mentionID + ">"
+}
+
+// messageSender sends a message somewhere, such as a channel or in response
+// to a slash command.
+type messageSender func(data *discordgo.MessageSend) (*discordgo.Message, error)
+
+func channelSender(dg *discordgo.Session, channelID string) messageSender {
+	return func(data *discordgo.MessageSend) (*discordgo.Message, error) {
+		return dg.ChannelMessageSendComplex(channelID, data)
+	}
+}
+
+// renderMessage sends a bot message, as an embed if they are enabled. If the
+// embed can't be sent, such as in a channel where the bot can't embed links,
+// it is sent as plain text instead.
+func renderMessage(useEmbeds bool, msg botMessage, send messageSender) (*discordgo.Message, error) {
+	if useEmbeds {
+		sent, err := send(&discordgo.MessageSend{
+			Content:    msg.mention(),
+			Embeds:     []*discordgo.MessageEmbed{msg.embed()},
+			Components: msg.components,
+		})
+		if err == nil {
+			return sent, nil
+		}
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Failed to send embed, sending plain text instead")
+	}
+	return send(&discordgo.MessageSend{Content: msg.text, Components: msg.components})
+}
+
+// sendMessage sends a bot message to a channel.
+func sendMessage(dg *discordgo.Session, useEmbeds bool, channelID string, msg botMessage) (*discordgo.Message, error) {
+	return renderMessage(useEmbeds, msg, channelSender(dg, channelID))
+}
+
+// editMessage replaces a message the bot sent with a new bot message. Any
+// buttons the message had are replaced too.
+func editMessage(dg *discordgo.Session, useEmbeds bool, channelID string, messageID string, msg botMessage) (*discordgo.Message, error) {
+	edit := discordgo.NewMessageEdit(channelID, messageID)
+	edit.Components = msg.components
+	if edit.Components == nil {
+		// Leaving components out would keep the old buttons
+		edit.Components = []discordgo.MessageComponent{}
+	}
+	if useEmbeds {
+		content := msg.mention()
+		edit.Content = &content
+		edit.SetEmbed(msg.embed())
+		return dg.ChannelMessageEditComplex(edit)
+	}
+	edit.Content = &msg.text
+	return dg.ChannelMessageEditComplex(edit)
+}
+
+// sendMessage sends a bot message in reply to a command.
+func (b *Bot) sendMessage(msg botMessage, m *commandContext) (*discordgo.Message, error) {
+	sent, err := renderMessage(b.conf.Bot.UseEmbeds, msg, m.sender(b.dg))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msg":   sent,
+			"error": err,
+		}).Error("Failed to send message")
+		return sent, err
+	}
+	b.autoDelete(sent)
+	return sent, err
+}
+
+// songFields describes a song in an embed.
+func songFields(song *PlaylistEntry) []*discordgo.MessageEmbedField {
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Length", Value: song.displayLength(), Inline: true},
+	}
+	if song.Channel != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Channel", Value: song.Channel, Inline: true})
+	}
+	requester := "Playlist"
+	if song.Requester != nil {
+		requester = song.Requester.Username
+	} else if song.Autoplayed {
+		requester = "Autoplay"
+	}
+	fields = append(fields, &discordgo.MessageEmbedField{Name: "Requested By", Value: requester, Inline: true})
+	return fields
+}
+
+// errorMessage is a reply telling a user something went wrong.
+func errorMessage(userID string, text string) botMessage {
+	return botMessage{
+		kind:        messageError,
+		mentionID:   userID,
+		description: text,
+		text:        "<@" + userID + "> - " + text,
+	}
+}
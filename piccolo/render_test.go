@@ -0,0 +1,38 @@
+package piccolo
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateDescription(t *testing.T) {
+	short := "short ♪ description"
+	if got := truncateDescription(short); got != short {
+		t.Errorf("Short description was changed to %q", got)
+	}
+	tests := []struct {
+		name        string
+		description string
+	}{
+		{"ascii", strings.Repeat("a", maxEmbedDescription+10)},
+		{"multi byte", strings.Repeat("♪", maxEmbedDescription+10)},
+		{"open code block", "```\n" + strings.Repeat("1. song\n", maxEmbedDescription/8+10) + "```"},
+		{"closed code block", "```\nsong\n```\n" + strings.Repeat("é", maxEmbedDescription)},
+	}
+	for _, test := range tests {
+		got := truncateDescription(test.description)
+		if !utf8.ValidString(got) {
+			t.Errorf("%s: truncated description isn't valid utf8", test.name)
+		}
+		if length := utf8.RuneCountInString(got); length > maxEmbedDescription {
+			t.Errorf("%s: truncated description is %d characters", test.name, length)
+		}
+		if !strings.HasSuffix(got, truncatedSuffix) {
+			t.Errorf("%s: truncated description doesn't end with %q", test.name, truncatedSuffix)
+		}
+		if strings.Count(got, codeFence)%2 != 0 {
+			t.Errorf("%s: truncated description leaves a code block open", test.name)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package piccolo
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/jatgam/goutils/log"
+)
+
+// slashDescriptionLength is the longest description discord accepts for a
+// slash command or one of its options.
+const slashDescriptionLength = 100
+
+// slashDescription fits a description in what discord accepts, keeping only
+// the first sentence of long ones.
+func slashDescription(description string) string {
+	if len([]rune(description)) > slashDescriptionLength {
+		if end := strings.Index(description, ". "); end > 0 {
+			description = description[:end+1]
+		}
+	}
+	runes := []rune(description)
+	if len(runes) > slashDescriptionLength {
+		return string(runes[:slashDescriptionLength-3]) + "..."
+	}
+	return description
+}
+
+// slashOption describes an argument as a slash command option. Numbers that
+// also take keywords, such as all, are strings so either can be typed.
+func slashOption(arg commandArg) *discordgo.ApplicationCommandOption {
+	option := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        strings.ToLower(arg.name),
+		Description: slashDescription(arg.description),
+		Required:    arg.required,
+	}
+	if option.Description == "" {
+		option.Description = arg.name
+	}
+	switch {
+	case arg.kind == argNumber && len(arg.keywords) == 0:
+		minValue := 1.0
+		option.Type = discordgo.ApplicationCommandOptionInteger
+		option.MinValue = &minValue
+	case arg.kind == argUser:
+		option.Type = discordgo.ApplicationCommandOptionUser
+	}
+	return option
+}
+
+// slashCommandDefinitions describes every command as a slash command, so the
+// two can't drift apart. Slash command names have to be lower case.
+func slashCommandDefinitions() []*discordgo.ApplicationCommand {
+	var definitions []*discordgo.ApplicationCommand
+	for _, cmd := range cmdHandler.getAllCommands() {
+		definition := &discordgo.ApplicationCommand{
+			Name:        strings.ToLower(cmd.name),
+			Description: slashDescription(cmd.description),
+		}
+		for _, arg := range cmd.args {
+			definition.Options = append(definition.Options, slashOption(arg))
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions
+}
+
+// registerSlashCommands creates the slash commands in every guild the bot
+// plays in, replacing any the bot registered before.
+func (b *Bot) registerSlashCommands(appID string) {
+	definitions := slashCommandDefinitions()
+	for guildID := range b.guildLookup {
+		_, err := b.dg.ApplicationCommandBulkOverwrite(appID, guildID, definitions)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"guild": guildID,
+				"error": err,
+			}).Error("Failed to register slash commands")
+		}
+	}
+}
+
+// newInteractionContext is a command run through an interaction, content is
+// the command as it would be typed.
+func newInteractionContext(i *discordgo.InteractionCreate, content string) *commandContext {
+	m := &commandContext{
+		ChannelID:   i.ChannelID,
+		GuildID:     i.GuildID,
+		Content:     content,
+		interaction: i.Interaction,
+		lock:        &sync.Mutex{},
+	}
+	if i.Member != nil {
+		m.Author = i.Member.User
+	} else {
+		m.Author = i.User
+	}
+	return m
+}
+
+// slashCommandContent writes out the options of a slash command as they would
+// be typed after the command name, returning the users that were mentioned.
+func slashCommandContent(data discordgo.ApplicationCommandInteractionData, prefix string, commandName string) (string, []*discordgo.User) {
+	content := []string{prefix + commandName}
+	var mentions []*discordgo.User
+	for _, option := range data.Options {
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionInteger:
+			content = append(content, strconv.FormatInt(option.IntValue(), 10))
+		case discordgo.ApplicationCommandOptionUser:
+			user := option.UserValue(nil)
+			if data.Resolved != nil {
+				if resolved, ok := data.Resolved.Users[user.ID]; ok {
+					user = resolved
+				}
+			}
+			mentions = append(mentions, user)
+			content = append(content, "<@"+user.ID+">")
+		default:
+			content = append(content, option.StringValue())
+		}
+	}
+	return strings.Join(content, " "), mentions
+}
+
+func (b *Bot) interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		b.slashCommand(s, i)
+	case discordgo.InteractionMessageComponent:
+		b.controlPanelPress(s, i)
+	}
+}
+
+func (b *Bot) slashCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	// Commands are found ignoring case, so the lower case slash command name
+	// is enough to find them
+	commandName := data.Name
+	if _, ok := b.textChannelLookup[i.ChannelID]; !ok {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Sorry, I don't take commands in this channel.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+	content, mentions := slashCommandContent(data, b.conf.CommandPrefix, commandName)
+	m := newInteractionContext(i, content)
+	m.Mentions = mentions
+	// Commands can take longer than discord waits for a response, such as
+	// when searching, so respond right away and fill in the reply later
+	if !b.deferInteraction(s, i, data.Name, 0) {
+		return
+	}
+	b.runInteraction(s, m, commandName)
+}
+
+// runInteraction runs a command for an interaction that has been deferred.
+func (b *Bot) runInteraction(s *discordgo.Session, m *commandContext, commandName string) {
+	foundCommand, found := cmdHandler.get(commandName)
+	if !found {
+		log.WithFields(log.Fields{
+			"cmd": commandName,
+		}).Error("Failed to find command")
+		m.sender(s)(&discordgo.MessageSend{Content: "Sorry, that command doesn't exist anymore."})
+		return
+	}
+	b.runCommand(foundCommand, m)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.replied {
+		// Don't leave the response loading forever
+		done := "Done."
+		s.InteractionResponseEdit(m.interaction, &discordgo.WebhookEdit{Content: &done})
+	}
+}
@@ -0,0 +1,57 @@
+package piccolo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSlashCommandDefinitions(t *testing.T) {
+	definitions := make(map[string]*discordgo.ApplicationCommand)
+	for _, definition := range slashCommandDefinitions() {
+		if definition.Name != strings.ToLower(definition.Name) {
+			t.Errorf("Slash command %s isn't lower case", definition.Name)
+		}
+		if len(definition.Description) == 0 || len([]rune(definition.Description)) > slashDescriptionLength {
+			t.Errorf("Slash command %s has a description of %d characters", definition.Name, len(definition.Description))
+		}
+		if _, found := cmdHandler.get(definition.Name); !found {
+			t.Errorf("Slash command %s doesn't run a command", definition.Name)
+		}
+		definitions[definition.Name] = definition
+	}
+	if len(definitions) != len(cmdHandler.getAllCommands()) {
+		t.Errorf("%d slash commands for %d commands", len(definitions), len(cmdHandler.getAllCommands()))
+	}
+
+	play := definitions["play"].Options
+	if len(play) != 1 || play[0].Type != discordgo.ApplicationCommandOptionString || !play[0].Required {
+		t.Errorf("play options = %+v, want a required string", play)
+	}
+	history := definitions["history"].Options
+	if len(history) != 2 || history[0].Type != discordgo.ApplicationCommandOptionInteger ||
+		history[1].Type != discordgo.ApplicationCommandOptionUser || history[0].Required {
+		t.Errorf("history options = %+v, want an optional integer and user", history)
+	}
+	// Days can be a number or all
+	stats := definitions["stats"].Options
+	if len(stats) != 1 || stats[0].Type != discordgo.ApplicationCommandOptionString {
+		t.Errorf("stats options = %+v, want a string", stats)
+	}
+}
+
+func TestSlashDescription(t *testing.T) {
+	short := "Show the song that is playing."
+	if got := slashDescription(short); got != short {
+		t.Errorf("slashDescription(%q) = %q", short, got)
+	}
+	sentences := "Search for a song. " + strings.Repeat("More about it ", 10)
+	if got := slashDescription(sentences); got != "Search for a song." {
+		t.Errorf("slashDescription kept %q, want the first sentence", got)
+	}
+	long := strings.Repeat("a", 150)
+	if got := slashDescription(long); len(got) != slashDescriptionLength || !strings.HasSuffix(got, "...") {
+		t.Errorf("slashDescription(%d characters) = %q", len(long), got)
+	}
+}
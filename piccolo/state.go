@@ -0,0 +1,154 @@
+package piccolo
+
+import (
+	"time"
+
+	"github.com/jonas747/dca"
+
+	"github.com/jatgam/goutils/log"
+)
+
+type playerState int
+
+const (
+	// stateStopped is the state before joining voice and after shutdown
+	stateStopped playerState = iota
+	// stateIdle is waiting for a song to be added to the request queue
+	stateIdle
+	// stateLoading is finding and opening the next song to play
+	stateLoading
+	statePlaying
+	statePaused
+)
+
+var (
+	playerStateNames = map[playerState]string{
+		stateStopped: "stopped",
+		stateIdle:    "idle",
+		stateLoading: "loading",
+		statePlaying: "playing",
+		statePaused:  "paused",
+	}
+
+	playerStateTransitions = map[playerState][]playerState{
+		stateStopped: {stateIdle},
+		stateIdle:    {stateLoading, stateStopped},
+		stateLoading: {stateIdle, statePlaying, stateStopped},
+		statePlaying: {statePaused, stateLoading, stateStopped},
+		statePaused:  {statePlaying, stateLoading, stateStopped},
+	}
+)
+
+func (s playerState) String() string {
+	return playerStateNames[s]
+}
+
+// canTransition checks if the player is allowed to move from one state to
+// another. Staying in the same state is always allowed.
+func (s playerState) canTransition(newState playerState) bool {
+	if s == newState {
+		return true
+	}
+	for _, allowed := range playerStateTransitions[s] {
+		if allowed == newState {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *player) getState() playerState {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	return p.state
+}
+
+// setState moves the player to a new state, returning false if that isn't a
+// valid transition from the current state.
+func (p *player) setState(newState playerState) bool {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	if !p.state.canTransition(newState) {
+		log.WithFields(log.Fields{
+			"guild": p.guildID,
+			"from":  p.state,
+			"to":    newState,
+		}).Debug("Invalid player state transition")
+		return false
+	}
+	log.WithFields(log.Fields{
+		"guild": p.guildID,
+		"from":  p.state,
+		"to":    newState,
+	}).Debug("Player state changed")
+	p.state = newState
+	return true
+}
+
+// playingSong returns the song currently playing or paused, or nil if there
+// isn't one.
+func (p *player) playingSong() *songAndPath {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	if p.state != statePlaying && p.state != statePaused {
+		return nil
+	}
+	return p.currentSong
+}
+
+func (p *player) currentStream() *dca.StreamingSession {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	return p.stream
+}
+
+// setCurrent sets the song being played and the stream playing it.
+func (p *player) setCurrent(song *songAndPath, stream *dca.StreamingSession) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.currentSong = song
+	p.stream = stream
+}
+
+// setLastSong remembers the last youtube song played, so autoplay can find
+// songs related to it.
+func (p *player) setLastSong(videoID string, title string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.lastVideoID = videoID
+	p.lastTitle = title
+}
+
+func (p *player) lastSong() (string, string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	return p.lastVideoID, p.lastTitle
+}
+
+// notifySongQueued wakes the play loop if it is idle. It never blocks, a
+// pending notification is enough to wake the loop.
+func (p *player) notifySongQueued() {
+	select {
+	case p.songQueuedChan <- struct{}{}:
+	default:
+	}
+}
+
+// waitForSong blocks until a song is queued, or if timeout is more than 0 until
+// it has passed. Returns false if the player was shutdown instead.
+func (p *player) waitForSong(timeout time.Duration) bool {
+	var timedOut <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+	select {
+	case <-p.songQueuedChan:
+		return true
+	case <-timedOut:
+		return true
+	case <-p.shutdownChan:
+		return false
+	}
+}
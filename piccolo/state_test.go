@@ -0,0 +1,167 @@
+package piccolo
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPlayer(state playerState) *player {
+	return &player{
+		state:          state,
+		stateLock:      &sync.Mutex{},
+		songQueuedChan: make(chan struct{}, 1),
+		skipChan:       make(chan struct{}, 1),
+		shutdownChan:   make(chan struct{}),
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[playerState][]playerState{
+		stateStopped: {stateStopped, stateIdle},
+		stateIdle:    {stateIdle, stateLoading, stateStopped},
+		stateLoading: {stateLoading, stateIdle, statePlaying, stateStopped},
+		statePlaying: {statePlaying, statePaused, stateLoading, stateStopped},
+		statePaused:  {statePaused, statePlaying, stateLoading, stateStopped},
+	}
+	states := []playerState{stateStopped, stateIdle, stateLoading, statePlaying, statePaused}
+	for _, from := range states {
+		for _, to := range states {
+			want := false
+			for _, s := range allowed[from] {
+				if s == to {
+					want = true
+				}
+			}
+			if got := from.canTransition(to); got != want {
+				t.Errorf("%s -> %s: canTransition = %t, want %t", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestSetState(t *testing.T) {
+	p := newTestPlayer(stateStopped)
+	path := []playerState{stateIdle, stateLoading, statePlaying, statePaused, statePlaying,
+		stateLoading, stateIdle, stateLoading, statePlaying, stateStopped}
+	for _, next := range path {
+		from := p.getState()
+		if !p.setState(next) {
+			t.Fatalf("%s -> %s was rejected", from, next)
+		}
+		if got := p.getState(); got != next {
+			t.Fatalf("state after %s -> %s is %s", from, next, got)
+		}
+	}
+}
+
+func TestSetStateRejected(t *testing.T) {
+	tests := []struct {
+		from playerState
+		to   playerState
+	}{
+		{stateStopped, stateLoading},
+		{stateStopped, statePlaying},
+		{stateStopped, statePaused},
+		{stateIdle, statePlaying},
+		{stateIdle, statePaused},
+		{stateLoading, statePaused},
+		{statePlaying, stateIdle},
+		{statePaused, stateIdle},
+	}
+	for _, test := range tests {
+		p := newTestPlayer(test.from)
+		if p.setState(test.to) {
+			t.Errorf("%s -> %s was allowed", test.from, test.to)
+		}
+		if got := p.getState(); got != test.from {
+			t.Errorf("%s -> %s changed the state to %s", test.from, test.to, got)
+		}
+	}
+}
+
+func TestWaitForSongQueued(t *testing.T) {
+	p := newTestPlayer(stateIdle)
+	// Notifying more than once must never block
+	p.notifySongQueued()
+	p.notifySongQueued()
+	if !p.waitForSong(0) {
+		t.Fatal("waitForSong returned false after a song was queued")
+	}
+}
+
+func TestWaitForSongWakes(t *testing.T) {
+	p := newTestPlayer(stateIdle)
+	woke := make(chan bool)
+	go func() {
+		woke <- p.waitForSong(0)
+	}()
+	p.notifySongQueued()
+	select {
+	case queued := <-woke:
+		if !queued {
+			t.Fatal("waitForSong returned false after a song was queued")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitForSong didn't wake when a song was queued")
+	}
+}
+
+func TestWaitForSongShutdown(t *testing.T) {
+	p := newTestPlayer(stateIdle)
+	woke := make(chan bool)
+	go func() {
+		woke <- p.waitForSong(0)
+	}()
+	close(p.shutdownChan)
+	select {
+	case queued := <-woke:
+		if queued {
+			t.Fatal("waitForSong returned true after shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitForSong didn't wake on shutdown")
+	}
+}
+
+func TestSkipBeforeWaiting(t *testing.T) {
+	p := newTestPlayer(statePlaying)
+	// The skip arrives while the song is still being announced
+	p.skipSong()
+	p.skipSong()
+	ended := make(chan error)
+	go func() {
+		ended <- p.waitForSongEnd(make(chan error))
+	}()
+	select {
+	case err := <-ended:
+		if err != errSkip {
+			t.Fatalf("waitForSongEnd returned %v, want errSkip", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Skip sent before waiting for the song was lost")
+	}
+}
+
+func TestClearSkip(t *testing.T) {
+	p := newTestPlayer(statePlaying)
+	p.skipSong()
+	p.clearSkip()
+	streamDone := make(chan error, 1)
+	streamDone <- io.EOF
+	if err := p.waitForSongEnd(streamDone); err != io.EOF {
+		t.Fatalf("waitForSongEnd returned %v, want the stream to finish", err)
+	}
+}
+
+func TestWaitForSongTimeout(t *testing.T) {
+	p := newTestPlayer(stateIdle)
+	start := time.Now()
+	if !p.waitForSong(10 * time.Millisecond) {
+		t.Fatal("waitForSong returned false after timing out")
+	}
+	if waited := time.Since(start); waited < 10*time.Millisecond {
+		t.Errorf("waitForSong returned after %s, before timing out", waited)
+	}
+}
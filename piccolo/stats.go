@@ -0,0 +1,276 @@
+package piccolo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/jatgam/goutils/log"
+)
+
+const statsDayFormat = "2006-01-02"
+
+type (
+	// SongStats tracks how often a song was requested, played and skipped
+	SongStats struct {
+		Title    string `json:"title"`
+		Requests int    `json:"requests"`
+		Plays    int    `json:"plays"`
+		Skips    int    `json:"skips"`
+	}
+
+	// RequesterStats tracks how many songs a user has requested
+	RequesterStats struct {
+		Name     string `json:"name"`
+		Requests int    `json:"requests"`
+	}
+
+	// DailyStats holds the aggregated listening statistics for a single day
+	DailyStats struct {
+		Songs            map[string]*SongStats      `json:"songs"`
+		Requesters       map[string]*RequesterStats `json:"requesters"`
+		ListeningSeconds float64                    `json:"listeningSeconds"`
+	}
+
+	// StatsJSON is used to handle marshalling and unmarshalling listening
+	// statistics to a file on disk
+	StatsJSON struct {
+		Days map[string]*DailyStats `json:"days"`
+	}
+
+	stats struct {
+		days          map[string]*DailyStats
+		statsPath     string
+		retentionDays int
+		lock          *sync.Mutex
+	}
+
+	statCount struct {
+		id    string
+		name  string
+		count int
+	}
+)
+
+func newDailyStats() *DailyStats {
+	return &DailyStats{
+		Songs:      make(map[string]*SongStats),
+		Requesters: make(map[string]*RequesterStats),
+	}
+}
+
+func newStats(statsPath string, retentionDays int) *stats {
+	s := &stats{
+		days:          make(map[string]*DailyStats),
+		statsPath:     statsPath,
+		retentionDays: retentionDays,
+		lock:          &sync.Mutex{},
+	}
+	s.loadStats()
+	return s
+}
+
+func (s *stats) loadStats() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	statsFileContents, err := ioutil.ReadFile(filepath.FromSlash(s.statsPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(s.statsPath),
+			"error": err,
+		}).Error("Failed to open stats file to read")
+		return fmt.Errorf("Couldn't read the stats file")
+	}
+	var fileStats = StatsJSON{}
+	jsonErr := json.Unmarshal(statsFileContents, &fileStats)
+	if jsonErr != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(s.statsPath),
+			"error": jsonErr,
+		}).Error("Failed to decode stats json")
+		return fmt.Errorf("Couldn't decode the stats file")
+	}
+	for day, dayStats := range fileStats.Days {
+		if dayStats.Songs == nil {
+			dayStats.Songs = make(map[string]*SongStats)
+		}
+		if dayStats.Requesters == nil {
+			dayStats.Requesters = make(map[string]*RequesterStats)
+		}
+		s.days[day] = dayStats
+	}
+	s.expire()
+	log.Debug("Loaded stats")
+	return nil
+}
+
+// saveStats must be called with the stats lock held.
+func (s *stats) saveStats() error {
+	statsDir := filepath.FromSlash(path.Dir(s.statsPath))
+	if _, err := os.Stat(statsDir); os.IsNotExist(err) {
+		err := os.MkdirAll(statsDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	jsonStats, _ := json.Marshal(&StatsJSON{Days: s.days})
+	err := ioutil.WriteFile(filepath.FromSlash(s.statsPath), jsonStats, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(s.statsPath),
+			"error": err,
+		}).Error("Failed to write stats json file")
+		return fmt.Errorf("Error saving stats file")
+	}
+	return nil
+}
+
+// expire drops any days older than the retention period. Must be called with
+// the stats lock held.
+func (s *stats) expire() {
+	if s.retentionDays <= 0 {
+		return
+	}
+	oldest := time.Now().AddDate(0, 0, -s.retentionDays).Format(statsDayFormat)
+	for day := range s.days {
+		if day < oldest {
+			delete(s.days, day)
+		}
+	}
+}
+
+// today returns the stats bucket for the current day. Must be called with the
+// stats lock held.
+func (s *stats) today() *DailyStats {
+	day := time.Now().Format(statsDayFormat)
+	if _, ok := s.days[day]; !ok {
+		s.expire()
+		s.days[day] = newDailyStats()
+	}
+	return s.days[day]
+}
+
+func (d *DailyStats) song(videoID string, title string) *SongStats {
+	if _, ok := d.Songs[videoID]; !ok {
+		d.Songs[videoID] = &SongStats{}
+	}
+	d.Songs[videoID].Title = title
+	return d.Songs[videoID]
+}
+
+func (s *stats) recordRequest(requester *discordgo.User, videoID string, title string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	day := s.today()
+	day.song(videoID, title).Requests++
+	if requester != nil {
+		if _, ok := day.Requesters[requester.ID]; !ok {
+			day.Requesters[requester.ID] = &RequesterStats{}
+		}
+		day.Requesters[requester.ID].Name = requester.Username
+		day.Requesters[requester.ID].Requests++
+	}
+	s.saveStats()
+}
+
+func (s *stats) recordPlay(song *PlaylistEntry, outcome string, listened time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	day := s.today()
+	songStats := day.song(song.id(), song.Title)
+	songStats.Plays++
+	if outcome == historySkipped {
+		songStats.Skips++
+	}
+	day.ListeningSeconds += listened.Seconds()
+	s.saveStats()
+}
+
+// summary merges the stats for the last numDays days into a single DailyStats.
+// If numDays is 0 or less, every retained day is included.
+func (s *stats) summary(numDays int) *DailyStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var oldest string
+	if numDays > 0 {
+		oldest = time.Now().AddDate(0, 0, -(numDays - 1)).Format(statsDayFormat)
+	}
+	total := newDailyStats()
+	for day, dayStats := range s.days {
+		if day < oldest {
+			continue
+		}
+		for videoID, songStats := range dayStats.Songs {
+			totalSong := total.song(videoID, songStats.Title)
+			totalSong.Requests += songStats.Requests
+			totalSong.Plays += songStats.Plays
+			totalSong.Skips += songStats.Skips
+		}
+		for userID, requesterStats := range dayStats.Requesters {
+			if _, ok := total.Requesters[userID]; !ok {
+				total.Requesters[userID] = &RequesterStats{Name: requesterStats.Name}
+			}
+			total.Requesters[userID].Requests += requesterStats.Requests
+		}
+		total.ListeningSeconds += dayStats.ListeningSeconds
+	}
+	return total
+}
+
+// topCounts sorts the counts from highest to lowest, and returns at most num
+// of them, ignoring any with a count of 0.
+func topCounts(counts []statCount, num int) []statCount {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count == counts[j].count {
+			return counts[i].name < counts[j].name
+		}
+		return counts[i].count > counts[j].count
+	})
+	var top []statCount
+	for _, c := range counts {
+		if c.count <= 0 || len(top) >= num {
+			break
+		}
+		top = append(top, c)
+	}
+	return top
+}
+
+func (d *DailyStats) topRequested(num int) []statCount {
+	var counts []statCount
+	for videoID, songStats := range d.Songs {
+		counts = append(counts, statCount{videoID, songStats.Title, songStats.Requests})
+	}
+	return topCounts(counts, num)
+}
+
+func (d *DailyStats) topSkipped(num int) []statCount {
+	var counts []statCount
+	for videoID, songStats := range d.Songs {
+		counts = append(counts, statCount{videoID, songStats.Title, songStats.Skips})
+	}
+	return topCounts(counts, num)
+}
+
+func (d *DailyStats) topRequesters(num int) []statCount {
+	var counts []statCount
+	for userID, requesterStats := range d.Requesters {
+		counts = append(counts, statCount{userID, requesterStats.Name, requesterStats.Requests})
+	}
+	return topCounts(counts, num)
+}
+
+func (d *DailyStats) listeningTime() time.Duration {
+	return (time.Duration(d.ListeningSeconds) * time.Second).Round(time.Second)
+}
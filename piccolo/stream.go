@@ -0,0 +1,87 @@
+package piccolo
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// downloadReaderPollInterval is how long to wait for more of a song to be
+// written, when playback catches up to the download.
+const downloadReaderPollInterval = 100 * time.Millisecond
+
+// errDownloadRestarted is returned when the download attempt a song was being
+// played from failed, and the download was started over in a new file.
+var errDownloadRestarted = errors.New("Download failed part way and was restarted")
+
+// downloadReader reads a song that is still being downloaded. When it reaches
+// the end of what has been written so far, it waits for more instead of
+// returning io.EOF, until the download is finished.
+type downloadReader struct {
+	file *os.File
+	job  *downloadJob
+	// partialPath is the file of the download attempt being read, empty if
+	// the complete song was opened
+	partialPath string
+}
+
+// newDownloadReader opens the partial file of a download in progress. If the
+// download finished in the meantime, the complete song is opened instead.
+func newDownloadReader(completePath string, job *downloadJob) (*downloadReader, error) {
+	partialPath := job.currentPartialPath()
+	var file *os.File
+	err := os.ErrNotExist
+	if partialPath != "" {
+		file, err = os.Open(filepath.FromSlash(partialPath))
+	}
+	if os.IsNotExist(err) && job.finished() && job.err == nil {
+		partialPath = ""
+		file, err = os.Open(filepath.FromSlash(completePath))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &downloadReader{file: file, job: job, partialPath: partialPath}, nil
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if r.job.finished() {
+			// Anything written before the download finished has been read
+			n, err = r.file.Read(p)
+			if n > 0 {
+				return n, nil
+			}
+			if r.job.err != nil {
+				return 0, r.job.err
+			}
+			if r.restarted() {
+				return 0, errDownloadRestarted
+			}
+			return 0, err
+		}
+		if r.restarted() {
+			// The attempt being read failed, and the retry is writing a
+			// different file that may not match what was already played
+			return 0, errDownloadRestarted
+		}
+		// Playback caught up with the download, wait for more to be written
+		time.Sleep(downloadReaderPollInterval)
+	}
+}
+
+// restarted checks if the download attempt being read was replaced by a
+// retry.
+func (r *downloadReader) restarted() bool {
+	return r.partialPath != "" && r.job.currentPartialPath() != r.partialPath
+}
+
+func (r *downloadReader) Close() error {
+	return r.file.Close()
+}
@@ -9,18 +9,55 @@ import (
 
 // BotConfig is used to the the bot specific configuration.
 type BotConfig struct {
-	Volume                 float64 `json:"volume"`
-	YtDlPath               string  `json:"ytdl_path"`
-	SaveVideos             bool    `json:"save_videos"`
-	CacheDir               string  `json:"cache_dir"`
-	UsePlaylist            bool    `json:"use_playlist"`
-	PlaylistPath           string  `json:"playlist_path"`
-	AutoPause              bool    `json:"auto_pause"`
-	DeleteMessages         bool    `json:"delete_messages"`
-	DeleteInvokingMessages bool    `json:"delete_invoking_messages"`
-	NowPlayingMentions     bool    `json:"now_playing_mentions"`
-	SkipsRequired          int     `json:"skips_required"`
-	SkipRatio              float64 `json:"skip_ratio"`
+	Volume                 float64  `json:"volume"`
+	YtDlPath               string   `json:"ytdl_path"`
+	SaveVideos             bool     `json:"save_videos"`
+	CacheDir               string   `json:"cache_dir"`
+	DataDir                string   `json:"data_dir"`
+	UsePlaylist            bool     `json:"use_playlist"`
+	PlaylistPath           string   `json:"playlist_path"`
+	AutoPause              bool     `json:"auto_pause"`
+	DeleteMessages         bool     `json:"delete_messages"`
+	DeleteInvokingMessages bool     `json:"delete_invoking_messages"`
+	NowPlayingMentions     bool     `json:"now_playing_mentions"`
+	SkipsRequired          int      `json:"skips_required"`
+	SkipRatio              float64  `json:"skip_ratio"`
+	HistoryLength          int      `json:"history_length"`
+	PlaylistNoRepeat       int      `json:"playlist_no_repeat"`
+	StatsWindowDays        int      `json:"stats_window_days"`
+	StatsRetentionDays     int      `json:"stats_retention_days"`
+	DropDislikedSongs      bool     `json:"drop_disliked_songs"`
+	DislikeThreshold       int      `json:"dislike_threshold"`
+	AutoplayRelated        bool     `json:"autoplay_related"`
+	AutoplayMaxLength      int      `json:"autoplay_max_length"`
+	DownloadWorkers        int      `json:"download_workers"`
+	PrefetchDepth          int      `json:"prefetch_depth"`
+	DownloadRetries        int      `json:"download_retries"`
+	DownloadRetryDelay     int      `json:"download_retry_delay"`
+	DownloadProgress       bool     `json:"download_progress"`
+	VerifyCacheOnStart     bool     `json:"verify_cache_on_start"`
+	CacheMaxSize           int      `json:"cache_max_size"`
+	CacheMaxAge            int      `json:"cache_max_age"`
+	StreamWhileDownloading bool     `json:"stream_while_downloading"`
+	StreamPrebuffer        int      `json:"stream_prebuffer"`
+	Extractors             []string `json:"extractors"`
+	SearchBackend          string   `json:"search_backend"`
+	InvidiousURL           string   `json:"invidious_url"`
+	SearchCacheTTL         int      `json:"search_cache_ttl"`
+	APIDailyQuota          int      `json:"api_daily_quota"`
+	QuotaWarnPercent       int      `json:"quota_warn_percent"`
+	APIBaseURL             string   `json:"api_base_url"`
+	APITimeout             int      `json:"api_timeout"`
+	MaxSongLength          int      `json:"max_song_length"`
+	SearchSafeSearch       string   `json:"search_safe_search"`
+	SearchRegion           string   `json:"search_region"`
+	SearchCategory         string   `json:"search_category"`
+	SearchRankKeywords     []string `json:"search_rank_keywords"`
+	UseEmbeds              bool     `json:"use_embeds"`
+	DeleteMessagesDelay    int      `json:"delete_messages_delay"`
+	PersistentNowPlaying   bool     `json:"persistent_now_playing"`
+	SlashCommands          bool     `json:"slash_commands"`
+	ControlPanel           bool     `json:"control_panel"`
 }
 
 // Guilds stores channel information for each guild/server your bot connects too
@@ -44,6 +81,7 @@ var (
 		Volume:                 0.35,
 		SaveVideos:             true,
 		CacheDir:               "video_cache",
+		DataDir:                "data",
 		UsePlaylist:            true,
 		PlaylistPath:           "conf/playlist.json",
 		AutoPause:              true,
@@ -52,6 +90,42 @@ var (
 		NowPlayingMentions:     true,
 		SkipsRequired:          4,
 		SkipRatio:              0.5,
+		HistoryLength:          500,
+		PlaylistNoRepeat:       10,
+		StatsWindowDays:        7,
+		StatsRetentionDays:     365,
+		DropDislikedSongs:      false,
+		DislikeThreshold:       3,
+		AutoplayRelated:        false,
+		AutoplayMaxLength:      600,
+		DownloadWorkers:        2,
+		PrefetchDepth:          3,
+		DownloadRetries:        2,
+		DownloadRetryDelay:     5,
+		DownloadProgress:       true,
+		VerifyCacheOnStart:     true,
+		CacheMaxSize:           2048,
+		CacheMaxAge:            30,
+		StreamWhileDownloading: true,
+		StreamPrebuffer:        5,
+		Extractors:             []string{"library", "ytdl"},
+		SearchBackend:          "",
+		InvidiousURL:           "",
+		SearchCacheTTL:         24,
+		APIDailyQuota:          10000,
+		QuotaWarnPercent:       80,
+		APIBaseURL:             "",
+		APITimeout:             10,
+		MaxSongLength:          0,
+		SearchSafeSearch:       "",
+		SearchRegion:           "",
+		SearchCategory:         "",
+		SearchRankKeywords:     []string{"official audio", "lyrics"},
+		UseEmbeds:              true,
+		DeleteMessagesDelay:    30,
+		PersistentNowPlaying:   false,
+		SlashCommands:          true,
+		ControlPanel:           true,
 	}
 	defaultConfig = Config{
 		CommandPrefix: "!",
@@ -0,0 +1,203 @@
+package youtube
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jatgam/goutils/log"
+)
+
+const (
+	// maxDCAFrameSize is larger than any opus frame ffmpeg will produce, a
+	// bigger frame means the file is corrupt.
+	maxDCAFrameSize = 4000
+
+	partialDownloadExt = ".part"
+	// stalePartialDownloadAge is how long a partial download must go without
+	// being written to before it is considered left behind
+	stalePartialDownloadAge = 10 * time.Minute
+)
+
+// CachedSong describes a song stored in the cache. A songs last access time is
+// stored as the modification time of its file, so it survives restarts.
+type CachedSong struct {
+	VideoID    string
+	FilePath   string
+	Size       int64
+	LastAccess time.Time
+}
+
+// ValidateDCAFile reads through every frame in a raw DCA file, returning an
+// error if the file has no frames, is truncated or has an invalid frame.
+func ValidateDCAFile(filePath string) error {
+	file, err := os.Open(filepath.FromSlash(filePath))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	numFrames := 0
+	for {
+		var frameSize int16
+		err := binary.Read(reader, binary.LittleEndian, &frameSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Truncated frame header after %d frames", numFrames)
+		}
+		if frameSize <= 0 || frameSize > maxDCAFrameSize {
+			return fmt.Errorf("Invalid frame size %d at frame %d", frameSize, numFrames)
+		}
+		_, err = io.CopyN(ioutil.Discard, reader, int64(frameSize))
+		if err != nil {
+			return fmt.Errorf("Truncated frame after %d frames", numFrames)
+		}
+		numFrames++
+	}
+	if numFrames == 0 {
+		return fmt.Errorf("No audio frames found")
+	}
+	return nil
+}
+
+// VerifyCache checks every DCA file in the cache directory, removing any that
+// are corrupt, along with any partial downloads left behind. Partial downloads
+// written to recently are kept, they may still be downloading. Returns the
+// video ids of the songs that were removed.
+func (yt Manager) VerifyCache() ([]string, error) {
+	var removed []string
+	cacheDir := filepath.ToSlash(yt.YTCacheDir)
+	files, err := ioutil.ReadDir(filepath.FromSlash(cacheDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return removed, nil
+		}
+		return removed, err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		filePath := path.Join(cacheDir, "/", file.Name())
+		if strings.HasSuffix(file.Name(), partialDownloadExt) {
+			if time.Since(file.ModTime()) < stalePartialDownloadAge {
+				// Probably still being downloaded, by this or another process
+				continue
+			}
+			log.WithFields(log.Fields{
+				"file": filepath.FromSlash(filePath),
+			}).Info("Removing partial download from cache")
+			os.Remove(filepath.FromSlash(filePath))
+			continue
+		}
+		if !strings.HasSuffix(file.Name(), ".dca") {
+			continue
+		}
+		if validErr := ValidateDCAFile(filePath); validErr != nil {
+			log.WithFields(log.Fields{
+				"file":  filepath.FromSlash(filePath),
+				"error": validErr,
+			}).Warn("Removing corrupt song from cache")
+			err := os.Remove(filepath.FromSlash(filePath))
+			if err != nil {
+				return removed, err
+			}
+			removed = append(removed, strings.TrimSuffix(file.Name(), ".dca"))
+		}
+	}
+	return removed, nil
+}
+
+// CachedSongs lists every song in the cache directory, ordered from least to
+// most recently used.
+func (yt Manager) CachedSongs() ([]CachedSong, error) {
+	var songs []CachedSong
+	cacheDir := filepath.ToSlash(yt.YTCacheDir)
+	files, err := ioutil.ReadDir(filepath.FromSlash(cacheDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return songs, nil
+		}
+		return songs, err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".dca") {
+			continue
+		}
+		songs = append(songs, CachedSong{
+			VideoID:    strings.TrimSuffix(file.Name(), ".dca"),
+			FilePath:   path.Join(cacheDir, "/", file.Name()),
+			Size:       file.Size(),
+			LastAccess: file.ModTime(),
+		})
+	}
+	sort.Slice(songs, func(i, j int) bool {
+		return songs[i].LastAccess.Before(songs[j].LastAccess)
+	})
+	return songs, nil
+}
+
+// TouchCachedSong marks a song in the cache as just used.
+func (yt Manager) TouchCachedSong(videoID string) error {
+	now := time.Now()
+	err := os.Chtimes(filepath.FromSlash(yt.DCAPath(videoID)), now, now)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveCachedSong deletes a song from the cache, it is not an error if the song
+// wasn't cached.
+func (yt Manager) RemoveCachedSong(videoID string) error {
+	err := os.Remove(filepath.FromSlash(yt.DCAPath(videoID)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// PruneCache removes songs that haven't been used within maxAge, then the least
+// recently used songs until the cache is no bigger than maxSize bytes. A
+// maxSize or maxAge of 0 disables that limit. Songs in protected are never
+// removed, even if that leaves the cache over its limits. Returns the songs
+// that were removed.
+func (yt Manager) PruneCache(maxSize int64, maxAge time.Duration, protected map[string]bool) ([]CachedSong, error) {
+	var removed []CachedSong
+	songs, err := yt.CachedSongs()
+	if err != nil {
+		return removed, err
+	}
+	var totalSize int64
+	for _, song := range songs {
+		totalSize += song.Size
+	}
+	for _, song := range songs {
+		if protected[song.VideoID] {
+			continue
+		}
+		expired := maxAge > 0 && time.Since(song.LastAccess) > maxAge
+		oversized := maxSize > 0 && totalSize > maxSize
+		if !expired && !oversized {
+			continue
+		}
+		err := yt.RemoveCachedSong(song.VideoID)
+		if err != nil {
+			return removed, err
+		}
+		totalSize -= song.Size
+		removed = append(removed, song)
+	}
+	return removed, nil
+}
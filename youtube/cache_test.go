@@ -0,0 +1,143 @@
+package youtube
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dcaFrames builds a raw DCA file, each frame is a size header followed by
+// that many bytes.
+func dcaFrames(sizes ...int) []byte {
+	var buf bytes.Buffer
+	for _, size := range sizes {
+		binary.Write(&buf, binary.LittleEndian, int16(size))
+		buf.Write(make([]byte, size))
+	}
+	return buf.Bytes()
+}
+
+func newTestCacheDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "piccolo-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestValidateDCAFile(t *testing.T) {
+	dir := newTestCacheDir(t)
+	defer os.RemoveAll(dir)
+	valid := dcaFrames(120, 160, 3000)
+	tests := []struct {
+		name     string
+		contents []byte
+		valid    bool
+	}{
+		{"valid", valid, true},
+		{"single frame", dcaFrames(1), true},
+		{"empty", nil, false},
+		{"truncated header", append(dcaFrames(120), 0x10), false},
+		{"truncated frame", valid[:len(valid)-1], false},
+		{"oversized frame", dcaFrames(120, maxDCAFrameSize+1), false},
+		{"zero size frame", dcaFrames(120, 0), false},
+		{"negative size frame", append(dcaFrames(120), 0xff, 0xff), false},
+	}
+	for _, test := range tests {
+		filePath := filepath.Join(dir, "song.dca")
+		if err := ioutil.WriteFile(filePath, test.contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := ValidateDCAFile(filepath.ToSlash(filePath))
+		if (err == nil) != test.valid {
+			t.Errorf("%s: ValidateDCAFile returned %v, want valid %t", test.name, err, test.valid)
+		}
+	}
+	if err := ValidateDCAFile(filepath.ToSlash(filepath.Join(dir, "missing.dca"))); err == nil {
+		t.Error("ValidateDCAFile accepted a file that doesn't exist")
+	}
+}
+
+// cacheSong writes a song of size bytes to the cache, last used age ago.
+func cacheSong(t *testing.T, yt Manager, videoID string, size int, age time.Duration) {
+	songPath := filepath.FromSlash(yt.DCAPath(videoID))
+	if err := ioutil.WriteFile(songPath, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lastUsed := time.Now().Add(-age)
+	if err := os.Chtimes(songPath, lastUsed, lastUsed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func cachedIDs(t *testing.T, yt Manager) []string {
+	songs, err := yt.CachedSongs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, song := range songs {
+		ids = append(ids, song.VideoID)
+	}
+	return ids
+}
+
+func TestPruneCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSize   int64
+		maxAge    time.Duration
+		protected map[string]bool
+		kept      []string
+	}{
+		{"no limits", 0, 0, nil, []string{"old", "older", "recent", "new"}},
+		{"max size removes least recently used", 250, 0, nil, []string{"recent", "new"}},
+		{"max age", 0, 3 * time.Hour, nil, []string{"recent", "new"}},
+		{"protected songs are kept", 200, 0, map[string]bool{"old": true}, []string{"old", "new"}},
+		{"protected songs can leave the cache too big", 50, 0, map[string]bool{"old": true, "new": true}, []string{"old", "new"}},
+		{"age and size", 100, 3 * time.Hour, nil, []string{"new"}},
+	}
+	for _, test := range tests {
+		dir := newTestCacheDir(t)
+		yt := Manager{YTCacheDir: filepath.ToSlash(dir)}
+		cacheSong(t, yt, "old", 100, 4*time.Hour)
+		cacheSong(t, yt, "older", 100, 5*time.Hour)
+		cacheSong(t, yt, "recent", 100, 2*time.Hour)
+		cacheSong(t, yt, "new", 100, time.Hour)
+		removed, err := yt.PruneCache(test.maxSize, test.maxAge, test.protected)
+		if err != nil {
+			t.Errorf("%s: PruneCache failed: %s", test.name, err)
+		}
+		kept := cachedIDs(t, yt)
+		os.RemoveAll(dir)
+		sort.Strings(kept)
+		sort.Strings(test.kept)
+		if strings.Join(kept, ",") != strings.Join(test.kept, ",") {
+			t.Errorf("%s: kept %v, want %v", test.name, kept, test.kept)
+		}
+		if len(removed)+len(kept) != 4 {
+			t.Errorf("%s: removed %d songs but kept %d of 4", test.name, len(removed), len(kept))
+		}
+	}
+}
+
+func TestCachedSongsOrder(t *testing.T) {
+	dir := newTestCacheDir(t)
+	defer os.RemoveAll(dir)
+	yt := Manager{YTCacheDir: filepath.ToSlash(dir)}
+	cacheSong(t, yt, "b", 10, time.Hour)
+	cacheSong(t, yt, "a", 10, 2*time.Hour)
+	cacheSong(t, yt, "c", 10, time.Minute)
+	if err := ioutil.WriteFile(filepath.Join(dir, "d.dca.part"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ids := strings.Join(cachedIDs(t, yt), ","); ids != "a,b,c" {
+		t.Errorf("CachedSongs returned %s, want least recently used first", ids)
+	}
+}
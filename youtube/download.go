@@ -1,20 +1,71 @@
 package youtube
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/jonas747/dca"
 	"github.com/rylio/ytdl"
 )
 
+type (
+	// DownloadProgress is called periodically while a video is downloading,
+	// with how much of the video has been encoded so far, and the total video
+	// length.
+	DownloadProgress func(encoded time.Duration, total time.Duration)
+
+	// DownloadStarted is called with the path of the partial file a download
+	// is being written to, before anything is written to it. The path uses
+	// forward slashes.
+	DownloadStarted func(partialPath string)
+)
+
+// DCAPath returns the path a video is stored at in the cache once it has been
+// downloaded and converted to DCA format. The path uses forward slashes.
+func (yt Manager) DCAPath(videoID string) string {
+	return path.Join(filepath.ToSlash(yt.YTCacheDir), "/", videoID+".dca")
+}
+
+func encodeOptions() *dca.EncodeOptions {
+	// Copy the standard options, so they aren't changed for everyone
+	options := *dca.StdEncodeOptions
+	options.RawOutput = true
+	options.Bitrate = 128
+	options.Application = "audio"
+	options.Volume = 125
+	return &options
+}
+
+// audioURL finds the url of the best audio format for a video.
+func audioURL(videoInfo *ytdl.VideoInfo) (string, error) {
+	formats := videoInfo.Formats.Extremes(ytdl.FormatAudioBitrateKey, true)
+	if len(formats) == 0 {
+		return "", fmt.Errorf("No audio formats found for video: %s", videoInfo.ID)
+	}
+	downloadURL, err := videoInfo.GetDownloadURL(formats[0])
+	if err != nil {
+		return "", err
+	}
+	return downloadURL.String(), nil
+}
+
 // DownloadDCAAudio takes a youtube video id, downloads the audio and then
 // converts the song to DCA format to be compatible with discordgo.
 func (yt Manager) DownloadDCAAudio(videoID string) (string, error) {
+	return yt.DownloadDCAAudioWithProgress(videoID, nil, nil)
+}
+
+// DownloadDCAAudioWithProgress is the same as DownloadDCAAudio, but calls
+// started with the partial file the song is written to, and progress every
+// second until the download finishes. started and progress may be nil.
+func (yt Manager) DownloadDCAAudioWithProgress(videoID string, started DownloadStarted, progress DownloadProgress) (string, error) {
 	cacheDir := filepath.ToSlash(yt.YTCacheDir)
-	outputFilePath := path.Join(cacheDir, "/", videoID+".dca")
+	outputFilePath := yt.DCAPath(videoID)
 
 	if _, err := os.Stat(filepath.FromSlash(cacheDir)); os.IsNotExist(err) {
 		err := os.MkdirAll(filepath.FromSlash(cacheDir), os.ModeDir)
@@ -23,35 +74,97 @@ func (yt Manager) DownloadDCAAudio(videoID string) (string, error) {
 		}
 	}
 
-	options := dca.StdEncodeOptions
-	options.RawOutput = true
-	options.Bitrate = 128
-	options.Application = "audio"
-	options.Volume = 125
-
-	videoInfo, err := ytdl.GetVideoInfo(videoID)
+	audio, err := yt.Extract(videoID)
 	if err != nil {
 		return "", err
 	}
 
-	format := videoInfo.Formats.Extremes(ytdl.FormatAudioBitrateKey, true)[0]
-	downloadURL, err := videoInfo.GetDownloadURL(format)
+	encodingSession, err := dca.EncodeFile(audio.URL, encodeOptions())
 	if err != nil {
 		return "", err
 	}
+	defer encodingSession.Cleanup()
 
-	encodingSession, err := dca.EncodeFile(downloadURL.String(), options)
+	// Write to a partial file first, so an interrupted download never leaves a
+	// truncated song in the cache. Every download gets its own partial file,
+	// so retries and other processes downloading the same song never write to
+	// or remove a file someone else is using. The partial file can be played
+	// while it is still downloading.
+	output, err := ioutil.TempFile(filepath.FromSlash(cacheDir), videoID+".*.dca"+partialDownloadExt)
 	if err != nil {
 		return "", err
 	}
-	defer encodingSession.Cleanup()
+	tempFilePath := output.Name()
+	defer os.Remove(tempFilePath)
+	if started != nil {
+		started(filepath.ToSlash(tempFilePath))
+	}
 
-	output, err := os.Create(filepath.FromSlash(outputFilePath))
+	if progress != nil {
+		copyDone := make(chan struct{})
+		defer close(copyDone)
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-copyDone:
+					return
+				case <-ticker.C:
+					progress(encodingSession.Stats().Duration, audio.Duration)
+				}
+			}
+		}()
+	}
+
+	_, err = io.Copy(output, encodingSession)
+	closeErr := output.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	if err := encodingSession.Error(); err != nil {
+		return "", err
+	}
+	if err := ValidateDCAFile(filepath.ToSlash(tempFilePath)); err != nil {
+		return "", err
+	}
+	err = moveIntoCache(tempFilePath, filepath.FromSlash(outputFilePath))
 	if err != nil {
 		return "", err
 	}
-
-	io.Copy(output, encodingSession)
 
 	return filepath.FromSlash(outputFilePath), nil
 }
+
+// moveIntoCache moves a finished download to its place in the cache. On
+// windows a file can't be renamed while it is open, such as when it is being
+// played as it downloads, so the song is copied instead.
+func moveIntoCache(tempFilePath string, outputFilePath string) error {
+	renameErr := os.Rename(tempFilePath, outputFilePath)
+	if renameErr == nil {
+		return nil
+	}
+	input, err := os.Open(tempFilePath)
+	if err != nil {
+		return renameErr
+	}
+	defer input.Close()
+	output, err := ioutil.TempFile(filepath.Dir(outputFilePath), filepath.Base(outputFilePath)+".*"+partialDownloadExt)
+	if err != nil {
+		return err
+	}
+	copyPath := output.Name()
+	defer os.Remove(copyPath)
+	_, err = io.Copy(output, input)
+	closeErr := output.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(copyPath, outputFilePath)
+}
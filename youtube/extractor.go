@@ -0,0 +1,147 @@
+package youtube
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rylio/ytdl"
+)
+
+const (
+	// ExtractorLibrary finds audio using the built in youtube library.
+	ExtractorLibrary = "library"
+	// ExtractorBinary finds audio by running a youtube-dl or yt-dlp binary.
+	ExtractorBinary = "ytdl"
+
+	defaultYtDlBinary = "yt-dlp"
+)
+
+type (
+	// Extractor finds where the audio for a youtube video can be streamed
+	// from.
+	Extractor interface {
+		Name() string
+		Extract(videoID string) (*ExtractedAudio, error)
+	}
+
+	// ExtractedAudio is the audio stream for a video, the url can be passed
+	// straight to ffmpeg.
+	ExtractedAudio struct {
+		URL      string
+		Duration time.Duration
+	}
+
+	libraryExtractor struct{}
+
+	binaryExtractor struct {
+		path string
+	}
+
+	binaryExtractorJSON struct {
+		URL      string  `json:"url"`
+		Duration float64 `json:"duration"`
+	}
+)
+
+func (e libraryExtractor) Name() string {
+	return ExtractorLibrary
+}
+
+func (e libraryExtractor) Extract(videoID string) (*ExtractedAudio, error) {
+	videoInfo, err := ytdl.GetVideoInfo(videoID)
+	if err != nil {
+		return nil, err
+	}
+	downloadURL, err := audioURL(videoInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &ExtractedAudio{URL: downloadURL, Duration: videoInfo.Duration}, nil
+}
+
+func (e binaryExtractor) Name() string {
+	return ExtractorBinary
+}
+
+func (e binaryExtractor) Extract(videoID string) (*ExtractedAudio, error) {
+	binary := e.path
+	if binary == "" {
+		binary = defaultYtDlBinary
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, "--dump-json", "--no-playlist", "--no-warnings", "-f", "bestaudio/best",
+		"https://www.youtube.com/watch?v="+videoID)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %s: %s", binary, err, strings.TrimSpace(stderr.String()))
+	}
+	var result binaryExtractorJSON
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("Couldn't decode %s output: %s", binary, err)
+	}
+	if result.URL == "" {
+		return nil, fmt.Errorf("No audio url found for video: %s", videoID)
+	}
+	return &ExtractedAudio{URL: result.URL, Duration: time.Duration(result.Duration * float64(time.Second))}, nil
+}
+
+// NewExtractor creates the extractor with the given name. ytDlPath is the
+// binary used by the ytdl extractor, if empty yt-dlp is looked for on the
+// path.
+func NewExtractor(name string, ytDlPath string) (Extractor, error) {
+	switch name {
+	case ExtractorLibrary:
+		return libraryExtractor{}, nil
+	case ExtractorBinary:
+		return binaryExtractor{path: ytDlPath}, nil
+	}
+	return nil, fmt.Errorf("Unknown extractor: %s", name)
+}
+
+// extractors returns the extractors to try, in order. The library is used if
+// none are configured.
+func (yt Manager) extractors() ([]Extractor, error) {
+	names := yt.Extractors
+	if len(names) == 0 {
+		names = []string{ExtractorLibrary}
+	}
+	var extractors []Extractor
+	for _, name := range names {
+		extractor, err := NewExtractor(name, yt.YtDlPath)
+		if err != nil {
+			return nil, err
+		}
+		extractors = append(extractors, extractor)
+	}
+	return extractors, nil
+}
+
+// ValidateExtractors checks every configured extractor exists, so a typo in
+// the config is found at startup rather than when a song is played.
+func (yt Manager) ValidateExtractors() error {
+	_, err := yt.extractors()
+	return err
+}
+
+// Extract finds the audio stream for a video, trying each configured
+// extractor in order until one works.
+func (yt Manager) Extract(videoID string) (*ExtractedAudio, error) {
+	extractors, err := yt.extractors()
+	if err != nil {
+		return nil, err
+	}
+	var failures []string
+	for _, extractor := range extractors {
+		audio, err := extractor.Extract(videoID)
+		if err == nil {
+			return audio, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", extractor.Name(), err))
+	}
+	return nil, fmt.Errorf("Every extractor failed for video %s (%s)", videoID, strings.Join(failures, "; "))
+}
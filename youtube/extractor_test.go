@@ -0,0 +1,159 @@
+package youtube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeYtDl writes a shell script standing in for yt-dlp, returning its path
+// and the directory it is in. Remove the directory when done with it.
+func fakeYtDl(t *testing.T, script string) (string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake yt-dlp is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "piccolo-ytdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "yt-dlp")
+	if err := ioutil.WriteFile(binary, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return binary, dir
+}
+
+func TestNewExtractor(t *testing.T) {
+	for _, name := range []string{ExtractorLibrary, ExtractorBinary} {
+		extractor, err := NewExtractor(name, "")
+		if err != nil {
+			t.Fatalf("NewExtractor(%s) failed: %s", name, err)
+		}
+		if extractor.Name() != name {
+			t.Errorf("NewExtractor(%s) created %s", name, extractor.Name())
+		}
+	}
+	if _, err := NewExtractor("youtube-dl", ""); err == nil {
+		t.Error("NewExtractor accepted an unknown extractor")
+	}
+}
+
+func TestValidateExtractors(t *testing.T) {
+	tests := []struct {
+		extractors []string
+		valid      bool
+	}{
+		{nil, true},
+		{[]string{ExtractorBinary, ExtractorLibrary}, true},
+		{[]string{ExtractorBinary, "ytdlp"}, false},
+	}
+	for _, test := range tests {
+		yt := Manager{Extractors: test.extractors}
+		if err := yt.ValidateExtractors(); (err == nil) != test.valid {
+			t.Errorf("ValidateExtractors(%v) = %v, want valid %t", test.extractors, err, test.valid)
+		}
+	}
+}
+
+func TestBinaryExtractor(t *testing.T) {
+	binary, dir := fakeYtDl(t, `echo "$@" > "$(dirname "$0")/args"
+echo '{"url":"http://audio.example/abc","duration":12.5}'
+`)
+	defer os.RemoveAll(dir)
+	audio, err := binaryExtractor{path: binary}.Extract("abc")
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if audio.URL != "http://audio.example/abc" {
+		t.Errorf("URL = %s", audio.URL)
+	}
+	if audio.Duration != 12500*time.Millisecond {
+		t.Errorf("Duration = %s", audio.Duration)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "--dump-json") || !strings.Contains(string(args), "https://www.youtube.com/watch?v=abc") {
+		t.Errorf("yt-dlp was run with: %s", args)
+	}
+}
+
+func TestBinaryExtractorFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"exit code", "echo 'ERROR: Video unavailable' >&2\nexit 1\n", "Video unavailable"},
+		{"malformed json", "echo 'not json'\n", "Couldn't decode"},
+		{"no url", "echo '{\"duration\":12}'\n", "No audio url"},
+	}
+	for _, test := range tests {
+		binary, dir := fakeYtDl(t, test.script)
+		_, err := binaryExtractor{path: binary}.Extract("abc")
+		os.RemoveAll(dir)
+		if err == nil {
+			t.Errorf("%s: Extract didn't fail", test.name)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %q doesn't mention %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestExtractFallback(t *testing.T) {
+	// Fails the first time it is run, and works after that
+	binary, dir := fakeYtDl(t, `state="$(dirname "$0")/ran"
+if [ ! -e "$state" ]; then
+	touch "$state"
+	echo 'ERROR: first attempt' >&2
+	exit 1
+fi
+echo '{"url":"http://audio.example/abc","duration":3}'
+`)
+	defer os.RemoveAll(dir)
+	yt := Manager{YtDlPath: binary, Extractors: []string{ExtractorBinary, ExtractorBinary}}
+	audio, err := yt.Extract("abc")
+	if err != nil {
+		t.Fatalf("Extract didn't fall back to the next extractor: %s", err)
+	}
+	if audio.URL != "http://audio.example/abc" {
+		t.Errorf("URL = %s", audio.URL)
+	}
+}
+
+func TestExtractEveryExtractorFails(t *testing.T) {
+	binary, dir := fakeYtDl(t, `count="$(dirname "$0")/count"
+echo x >> "$count"
+echo "ERROR: attempt $(wc -l < "$count" | tr -d ' ')" >&2
+exit 1
+`)
+	defer os.RemoveAll(dir)
+	yt := Manager{YtDlPath: binary, Extractors: []string{ExtractorBinary, ExtractorBinary}}
+	_, err := yt.Extract("abc")
+	if err == nil {
+		t.Fatal("Extract didn't fail")
+	}
+	first := strings.Index(err.Error(), "attempt 1")
+	second := strings.Index(err.Error(), "attempt 2")
+	if first < 0 || second < first {
+		t.Errorf("error doesn't list both failures in order: %s", err)
+	}
+}
+
+func TestExtractUnknownExtractor(t *testing.T) {
+	binary, dir := fakeYtDl(t, "touch \"$(dirname \"$0\")/ran\"\nexit 1\n")
+	defer os.RemoveAll(dir)
+	yt := Manager{YtDlPath: binary, Extractors: []string{ExtractorBinary, "ytdlp"}}
+	if _, err := yt.Extract("abc"); err == nil {
+		t.Fatal("Extract accepted an unknown extractor")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+		t.Error("an extractor was run before the config was checked")
+	}
+}
@@ -0,0 +1,191 @@
+package youtube
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jonas747/dca"
+)
+
+// streamProbeTimeout is how long to wait for a stream to answer, when checking
+// if a url is a live stream.
+const streamProbeTimeout = 10 * time.Second
+
+// playlistStreamTypes are the content types of HLS playlists, which ffmpeg
+// plays as a live stream.
+var playlistStreamTypes = map[string]bool{
+	"application/vnd.apple.mpegurl": true,
+	"application/x-mpegurl":         true,
+	"audio/mpegurl":                 true,
+	"audio/x-mpegurl":               true,
+}
+
+// privateNetworks are the address ranges that aren't reachable from the
+// internet, on top of the loopback, link-local and multicast ones net.IP
+// already knows about. Streams on these are refused, so a link to a radio
+// station can't be used to reach the bot's own machine or network.
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isPublicIP checks if an address is reachable from the internet.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkStreamURL makes sure a stream url is http(s) and that its host only
+// resolves to public addresses.
+func checkStreamURL(ctx context.Context, streamURL *url.URL) error {
+	if streamURL.Scheme != "http" && streamURL.Scheme != "https" {
+		return fmt.Errorf("Unsupported stream scheme %q", streamURL.Scheme)
+	}
+	host := streamURL.Hostname()
+	if host == "" {
+		return fmt.Errorf("Stream url has no host")
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return fmt.Errorf("Stream host %s resolves to non public address %s", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// dialPublicOnly refuses connections to non public addresses. It's checked
+// when connecting, so a host can't pass checkStreamURL and then resolve to
+// somewhere else.
+func dialPublicOnly(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("Refusing to connect to non public address %s", host)
+	}
+	return nil
+}
+
+// streamClient is used to probe stream urls. It only connects to public
+// addresses, including when following redirects, and ignores any proxy so the
+// address checked is the one connected to.
+func streamClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: streamProbeTimeout,
+		Control: dialPublicOnly,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: streamProbeTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("Stream redirected too many times")
+			}
+			return checkStreamURL(req.Context(), req.URL)
+		},
+	}
+}
+
+// LiveStreamURL finds a url ffmpeg can play for a youtube live broadcast.
+func (yt Manager) LiveStreamURL(videoID string) (string, error) {
+	audio, err := yt.Extract(videoID)
+	if err != nil {
+		return "", err
+	}
+	return audio.URL, nil
+}
+
+// IsLiveStream checks if a url is a live audio stream, such as an internet
+// radio station or an HLS playlist. Links to web pages or to audio files that
+// have an end are not live streams. Urls on private or local networks are
+// refused, since ffmpeg would otherwise fetch them for whoever asked.
+func (yt Manager) IsLiveStream(streamURL string) (bool, error) {
+	parsedURL, err := url.Parse(streamURL)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), streamProbeTimeout)
+	defer cancel()
+	if err := checkStreamURL(ctx, parsedURL); err != nil {
+		return false, err
+	}
+	if strings.EqualFold(path.Ext(parsedURL.Path), ".m3u8") {
+		return true, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return false, err
+	}
+	// Shoutcast and icecast servers only send their icy headers when asked
+	req.Header.Set("Icy-MetaData", "1")
+	resp, err := streamClient().Do(req)
+	if err != nil {
+		return false, err
+	}
+	// Only the headers are needed, a live stream never finishes sending its body
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Stream responded with %s", resp.Status)
+	}
+	if resp.Header.Get("icy-name") != "" || resp.Header.Get("icy-metaint") != "" || resp.Header.Get("icy-br") != "" {
+		return true, nil
+	}
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false, nil
+	}
+	if playlistStreamTypes[contentType] {
+		return true, nil
+	}
+	// Audio without a length keeps going until the stream is stopped
+	isAudio := strings.HasPrefix(contentType, "audio/") || contentType == "application/ogg"
+	return isAudio && resp.ContentLength < 0, nil
+}
+
+// EncodeLiveStream starts converting a live stream, such as an internet radio
+// station, to opus frames that can be sent straight to discord. Nothing is
+// written to the cache. Call Cleanup on the returned session when done with
+// it to stop ffmpeg.
+func (yt Manager) EncodeLiveStream(streamURL string) (*dca.EncodeSession, error) {
+	return dca.EncodeFile(streamURL, encodeOptions())
+}
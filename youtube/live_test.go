@@ -0,0 +1,68 @@
+package youtube
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":          true,
+		"2001:4860::8888":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"0.0.0.0":          false,
+		"10.1.2.3":         false,
+		"172.20.0.1":       false,
+		"192.168.1.1":      false,
+		"100.64.0.1":       false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"224.0.0.1":        false,
+		"::ffff:127.0.0.1": false,
+	}
+	for address, want := range tests {
+		if got := isPublicIP(net.ParseIP(address)); got != want {
+			t.Errorf("isPublicIP(%s) = %t, want %t", address, got, want)
+		}
+	}
+}
+
+func TestIsLiveStreamRefusesPrivateHosts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Probed a stream on a private address: %s", r.URL)
+		w.Header().Set("icy-name", "Local Radio")
+	}))
+	defer srv.Close()
+	urls := []string{
+		srv.URL + "/radio",
+		srv.URL + "/radio.m3u8",
+		"http://localhost/radio",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/radio",
+		"file:///etc/passwd",
+		"http:///radio",
+	}
+	yt := Manager{HTTPClient: srv.Client()}
+	for _, streamURL := range urls {
+		live, err := yt.IsLiveStream(streamURL)
+		if err == nil || live {
+			t.Errorf("IsLiveStream(%s) = %t, %v, want an error", streamURL, live, err)
+		}
+	}
+}
+
+func TestStreamClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Connected to a private address: %s", r.URL)
+	}))
+	defer srv.Close()
+	resp, err := streamClient().Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Error("streamClient connected to a loopback address")
+	}
+}
@@ -0,0 +1,224 @@
+package youtube
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jatgam/goutils/log"
+)
+
+// Cost in quota units of each youtube data api request used.
+const (
+	searchQuotaCost = 100
+	videosQuotaCost = 1
+)
+
+// ErrQuotaExceeded is returned when the youtube data api quota for the day has
+// been used up.
+var ErrQuotaExceeded = errors.New("YouTube API quota exceeded")
+
+type (
+	// QuotaJSON is used to handle marshalling and unmarshalling the api quota
+	// used today to a file on disk
+	QuotaJSON struct {
+		Day       string `json:"day"`
+		Used      int    `json:"used"`
+		Exhausted bool   `json:"exhausted"`
+	}
+
+	// QuotaTracker counts the youtube data api quota units used each day, so
+	// the bot can stop before the quota runs out. A nil tracker tracks
+	// nothing.
+	QuotaTracker struct {
+		// OnWarning is called once a day, when the used quota first reaches
+		// the warning percentage.
+		OnWarning func(used int, limit int)
+
+		quotaPath   string
+		limit       int
+		warnPercent int
+		day         string
+		used        int
+		exhausted   bool
+		lock        *sync.Mutex
+	}
+)
+
+// NewQuotaTracker creates a quota tracker stored at quotaPath. A limit of 0
+// disables the limit, only counting units.
+func NewQuotaTracker(quotaPath string, limit int, warnPercent int) *QuotaTracker {
+	q := &QuotaTracker{quotaPath: quotaPath, limit: limit, warnPercent: warnPercent, lock: &sync.Mutex{}}
+	q.loadQuota()
+	return q
+}
+
+// quotaDay is the day quota is counted for, the quota resets at midnight
+// pacific time.
+func quotaDay() string {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		location = time.UTC
+	}
+	return time.Now().In(location).Format("2006-01-02")
+}
+
+func (q *QuotaTracker) loadQuota() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	quotaFileContents, err := ioutil.ReadFile(filepath.FromSlash(q.quotaPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(q.quotaPath),
+			"error": err,
+		}).Error("Failed to open quota file to read")
+		return fmt.Errorf("Couldn't read the quota file")
+	}
+	var fileQuota = QuotaJSON{}
+	jsonErr := json.Unmarshal(quotaFileContents, &fileQuota)
+	if jsonErr != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(q.quotaPath),
+			"error": jsonErr,
+		}).Error("Failed to decode quota json")
+		return fmt.Errorf("Couldn't decode the quota file")
+	}
+	q.day = fileQuota.Day
+	q.used = fileQuota.Used
+	q.exhausted = fileQuota.Exhausted
+	return nil
+}
+
+// saveQuota must be called with the quota lock held.
+func (q *QuotaTracker) saveQuota() error {
+	quotaDir := filepath.FromSlash(path.Dir(q.quotaPath))
+	if _, err := os.Stat(quotaDir); os.IsNotExist(err) {
+		err := os.MkdirAll(quotaDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	jsonQuota, _ := json.MarshalIndent(&QuotaJSON{Day: q.day, Used: q.used, Exhausted: q.exhausted}, "", "    ")
+	err := ioutil.WriteFile(filepath.FromSlash(q.quotaPath), jsonQuota, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(q.quotaPath),
+			"error": err,
+		}).Error("Failed to write quota json file")
+		return fmt.Errorf("Error saving quota file")
+	}
+	return nil
+}
+
+// rollover starts counting from 0 when a new day starts. Must be called with
+// the quota lock held.
+func (q *QuotaTracker) rollover() {
+	if today := quotaDay(); q.day != today {
+		q.day = today
+		q.used = 0
+		q.exhausted = false
+	}
+}
+
+// allow checks if there is enough quota left today for a request costing
+// units.
+func (q *QuotaTracker) allow(units int) bool {
+	if q == nil {
+		return true
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.rollover()
+	if q.exhausted {
+		return false
+	}
+	return q.limit <= 0 || q.used+units <= q.limit
+}
+
+// use records units spent on a request.
+func (q *QuotaTracker) use(units int) {
+	if q == nil {
+		return
+	}
+	q.lock.Lock()
+	q.rollover()
+	before := q.used
+	q.used += units
+	warn := q.limit > 0 && q.warnPercent > 0 &&
+		before*100 < q.limit*q.warnPercent && q.used*100 >= q.limit*q.warnPercent
+	used, limit := q.used, q.limit
+	q.saveQuota()
+	q.lock.Unlock()
+	if warn {
+		log.WithFields(log.Fields{
+			"used":  used,
+			"limit": limit,
+		}).Warn("YouTube API quota is running low")
+		if q.OnWarning != nil {
+			q.OnWarning(used, limit)
+		}
+	}
+}
+
+// markExhausted stops api requests until the quota resets, after youtube says
+// the quota has run out.
+func (q *QuotaTracker) markExhausted() {
+	if q == nil {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.rollover()
+	if !q.exhausted {
+		log.WithFields(log.Fields{
+			"used": q.used,
+		}).Error("YouTube API quota exhausted, falling back until it resets")
+	}
+	q.exhausted = true
+	q.saveQuota()
+}
+
+// Usage returns the quota units used today and the daily limit.
+func (q *QuotaTracker) Usage() (used int, limit int) {
+	if q == nil {
+		return 0, 0
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.rollover()
+	return q.used, q.limit
+}
+
+// apiGet makes a youtube data api request costing units of quota. If youtube
+// says the quota has run out, no more requests are made until it resets.
+func (yt Manager) apiGet(apiURL string, units int) (*http.Response, error) {
+	if !yt.Quota.allow(units) {
+		return nil, ErrQuotaExceeded
+	}
+	resp, err := yt.httpClient().Get(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	yt.Quota.use(units)
+	if resp.StatusCode == http.StatusForbidden {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if strings.Contains(string(body), "quotaExceeded") || strings.Contains(string(body), "dailyLimitExceeded") {
+			yt.Quota.markExhausted()
+			return nil, ErrQuotaExceeded
+		}
+		return nil, fmt.Errorf("Got a bad http response: %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,137 @@
+package youtube
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestQuotaTracker(t *testing.T, limit int, warnPercent int) (*QuotaTracker, string) {
+	dir, err := ioutil.TempDir("", "piccolo-quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewQuotaTracker(filepath.ToSlash(filepath.Join(dir, "quota.json")), limit, warnPercent), dir
+}
+
+func TestQuotaLimit(t *testing.T) {
+	q, dir := newTestQuotaTracker(t, 250, 0)
+	defer os.RemoveAll(dir)
+	for i := 0; i < 2; i++ {
+		if !q.allow(searchQuotaCost) {
+			t.Fatalf("Search %d wasn't allowed", i+1)
+		}
+		q.use(searchQuotaCost)
+	}
+	if q.allow(searchQuotaCost) {
+		t.Error("Search over the limit was allowed")
+	}
+	if !q.allow(videosQuotaCost) {
+		t.Error("Request within the limit wasn't allowed")
+	}
+	if used, limit := q.Usage(); used != 200 || limit != 250 {
+		t.Errorf("Usage = %d of %d, want 200 of 250", used, limit)
+	}
+	// The usage is saved, so it survives a restart
+	reloaded := NewQuotaTracker(q.quotaPath, 250, 0)
+	if used, _ := reloaded.Usage(); used != 200 {
+		t.Errorf("Reloaded usage = %d, want 200", used)
+	}
+}
+
+func TestQuotaNoLimit(t *testing.T) {
+	q, dir := newTestQuotaTracker(t, 0, 80)
+	defer os.RemoveAll(dir)
+	q.OnWarning = func(used int, limit int) {
+		t.Error("Warned without a limit")
+	}
+	for i := 0; i < 5; i++ {
+		q.use(searchQuotaCost)
+	}
+	if !q.allow(searchQuotaCost) {
+		t.Error("Request wasn't allowed without a limit")
+	}
+}
+
+func TestQuotaWarnsOnce(t *testing.T) {
+	q, dir := newTestQuotaTracker(t, 1000, 50)
+	defer os.RemoveAll(dir)
+	warnings := 0
+	q.OnWarning = func(used int, limit int) {
+		warnings++
+		if used != 500 || limit != 1000 {
+			t.Errorf("Warned at %d of %d, want 500 of 1000", used, limit)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		q.use(searchQuotaCost)
+	}
+	if warnings != 1 {
+		t.Errorf("Warned %d times, want once", warnings)
+	}
+}
+
+func TestQuotaExhausted(t *testing.T) {
+	q, dir := newTestQuotaTracker(t, 10000, 0)
+	defer os.RemoveAll(dir)
+	q.markExhausted()
+	if q.allow(videosQuotaCost) {
+		t.Error("Request was allowed after the quota was exhausted")
+	}
+	reloaded := NewQuotaTracker(q.quotaPath, 10000, 0)
+	if reloaded.allow(videosQuotaCost) {
+		t.Error("Exhausted quota was forgotten after a restart")
+	}
+}
+
+func TestQuotaRollover(t *testing.T) {
+	q, dir := newTestQuotaTracker(t, 100, 0)
+	defer os.RemoveAll(dir)
+	q.use(searchQuotaCost)
+	q.markExhausted()
+	// Pretend the quota was used yesterday
+	q.day = "2000-01-01"
+	if !q.allow(searchQuotaCost) {
+		t.Error("Quota didn't reset on a new day")
+	}
+	if used, _ := q.Usage(); used != 0 {
+		t.Errorf("Usage = %d after a new day, want 0", used)
+	}
+}
+
+func TestNilQuotaTracker(t *testing.T) {
+	var q *QuotaTracker
+	q.use(searchQuotaCost)
+	q.markExhausted()
+	if !q.allow(searchQuotaCost) {
+		t.Error("A nil tracker didn't allow a request")
+	}
+	if used, limit := q.Usage(); used != 0 || limit != 0 {
+		t.Errorf("A nil tracker has usage %d of %d", used, limit)
+	}
+}
+
+func TestAPIGetMarksExhausted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"errors": [{"reason": "quotaExceeded"}]}}`))
+	}))
+	defer srv.Close()
+	q, dir := newTestQuotaTracker(t, 10000, 0)
+	defer os.RemoveAll(dir)
+	yt := Manager{HTTPClient: srv.Client(), Quota: q}
+	if _, err := yt.apiGet(srv.URL, searchQuotaCost); err != ErrQuotaExceeded {
+		t.Fatalf("apiGet returned %v, want ErrQuotaExceeded", err)
+	}
+	if q.allow(videosQuotaCost) {
+		t.Error("Quota wasn't marked exhausted")
+	}
+	// No more requests are made until the quota resets
+	srv.Close()
+	if _, err := yt.apiGet(srv.URL, videosQuotaCost); err != ErrQuotaExceeded {
+		t.Errorf("apiGet returned %v once exhausted, want ErrQuotaExceeded", err)
+	}
+}
@@ -5,18 +5,57 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/jatgam/goutils/log"
 )
 
+// DefaultAPIBaseURL is the youtube data api url used when no other is
+// configured.
+const DefaultAPIBaseURL = "https://www.googleapis.com/youtube/v3"
+
+// searchMaxResults is how many results are asked for, so there is a choice
+// when ranking them.
+const searchMaxResults = 10
+
+func (yt Manager) httpClient() *http.Client {
+	if yt.HTTPClient != nil {
+		return yt.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// apiURL returns the url of a youtube data api endpoint.
+func (yt Manager) apiURL(endpoint string) string {
+	baseURL := yt.APIBaseURL
+	if baseURL == "" {
+		baseURL = DefaultAPIBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + endpoint
+}
+
 func (yt Manager) createSearchURL(searchString string) (*string, error) {
-	searchURL, err := url.Parse("https://www.googleapis.com/youtube/v3/search")
+	searchURL, err := url.Parse(yt.apiURL("search"))
 	if err != nil {
 		return nil, err
 	}
 	searchParameters := url.Values{}
 	searchParameters.Add("part", "snippet")
 	searchParameters.Add("q", searchString)
+	// Channels and playlists can't be played
+	searchParameters.Add("type", "video")
+	searchParameters.Add("maxResults", strconv.Itoa(searchMaxResults))
+	if yt.SafeSearch != "" {
+		searchParameters.Add("safeSearch", yt.SafeSearch)
+	}
+	if yt.RegionCode != "" {
+		searchParameters.Add("regionCode", yt.RegionCode)
+	}
+	if yt.VideoCategoryID != "" {
+		searchParameters.Add("videoCategoryId", yt.VideoCategoryID)
+	}
 	searchParameters.Add("key", yt.APIKey)
 
 	searchURL.RawQuery = searchParameters.Encode()
@@ -24,41 +63,127 @@ func (yt Manager) createSearchURL(searchString string) (*string, error) {
 	return &searchStr, nil
 }
 
-// Search takes a string input and searches youtube for results. Search returns a
-// YoutubeSearchListResponse with the results.
+// Search takes a string input and searches youtube for results, using the
+// configured search backend. Search returns a YoutubeSearchListResponse with
+// the results.
 func (yt Manager) Search(searchStr string) (SearchListResponse, error) {
+	backend := yt.searchBackend()
+	cacheKey := yt.searchCacheKey(backend, searchStr)
+	if cached, ok := yt.SearchCache.get(cacheKey); ok {
+		return cached, nil
+	}
+	searchResponse, err := yt.searchWith(backend, searchStr)
+	if err == ErrQuotaExceeded {
+		fallback := yt.fallbackSearchBackend()
+		log.WithFields(log.Fields{
+			"backend": fallback,
+		}).Warn("YouTube API quota exceeded, searching with fallback backend")
+		searchResponse, err = yt.searchWith(fallback, searchStr)
+	}
+	if err != nil {
+		return searchResponse, err
+	}
+	yt.SearchCache.put(cacheKey, searchResponse)
+	return searchResponse, nil
+}
+
+func (yt Manager) searchWith(backend string, searchStr string) (SearchListResponse, error) {
+	switch backend {
+	case SearchBackendAPI:
+		return yt.apiSearch(searchStr)
+	case SearchBackendYtDl:
+		return yt.ytDlSearch(searchStr)
+	case SearchBackendInvidious:
+		return yt.invidiousSearch(searchStr)
+	}
+	return SearchListResponse{}, fmt.Errorf("Unknown search backend: %s", backend)
+}
+
+// fallbackSearchBackend is the search backend used when the api quota has run
+// out.
+func (yt Manager) fallbackSearchBackend() string {
+	if yt.InvidiousURL != "" {
+		return SearchBackendInvidious
+	}
+	return SearchBackendYtDl
+}
+
+// apiSearch searches using the youtube data api, which needs an api key.
+func (yt Manager) apiSearch(searchStr string) (SearchListResponse, error) {
 	var searchResponse SearchListResponse
 	searchURL, err := yt.createSearchURL(searchStr)
 	if err != nil {
 		return searchResponse, err
 	}
-	resp, err := http.Get(*searchURL)
+	resp, err := yt.apiGet(*searchURL, searchQuotaCost)
 	if err != nil {
 		log.Printf("[WARN] Error searching: %s", err)
 		return searchResponse, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		log.Printf("[WARN] Search failed with status: %s", resp.Status)
 		return searchResponse, fmt.Errorf("Got a bad http response: %s", resp.Status)
 	}
 
-	json.NewDecoder(resp.Body).Decode(&searchResponse)
+	err = json.NewDecoder(resp.Body).Decode(&searchResponse)
+	if err != nil {
+		log.Printf("[WARN] Failed to decode search results: %s", err)
+		return searchResponse, fmt.Errorf("Couldn't decode search results: %s", err)
+	}
 
 	return searchResponse, nil
 }
 
 // SearchFirstResult takes a string input and searches youtube, returning only
-// the first result in a YoutubeSearchResult
+// the best ranked video in a YoutubeSearchResult
 func (yt Manager) SearchFirstResult(searchStr string) (SearchResult, error) {
 	var searchResult SearchResult
 	searchResponseList, err := yt.Search(searchStr)
 	if err != nil {
 		return searchResult, err
 	}
-	if len(searchResponseList.Items) == 0 {
+	ranked := RankResults(searchResponseList.Items, yt.RankKeywords)
+	if len(ranked) == 0 {
 		log.Printf("[INFO] Search returned no results: %s", searchStr)
 		return searchResult, fmt.Errorf("Search returned no results: %s", searchStr)
 	}
-	searchResult = searchResponseList.Items[0]
+	searchResult = ranked[0]
 	return searchResult, nil
 }
+
+// RankResults drops results that aren't videos, then orders the rest so
+// videos with more of the keywords in their title come first. Videos with
+// the same number of keywords stay in the order youtube returned them.
+func RankResults(results []SearchResult, keywords []string) []SearchResult {
+	var videos []SearchResult
+	var scores []int
+	for _, result := range results {
+		if result.ID.VideoID == "" {
+			continue
+		}
+		title := strings.ToLower(result.Snippet.Title)
+		score := 0
+		for _, keyword := range keywords {
+			if keyword != "" && strings.Contains(title, strings.ToLower(keyword)) {
+				score++
+			}
+		}
+		videos = append(videos, result)
+		scores = append(scores, score)
+	}
+	sort.Stable(rankedResults{videos, scores})
+	return videos
+}
+
+type rankedResults struct {
+	results []SearchResult
+	scores  []int
+}
+
+func (r rankedResults) Len() int           { return len(r.results) }
+func (r rankedResults) Less(i, j int) bool { return r.scores[i] > r.scores[j] }
+func (r rankedResults) Swap(i, j int) {
+	r.results[i], r.results[j] = r.results[j], r.results[i]
+	r.scores[i], r.scores[j] = r.scores[j], r.scores[i]
+}
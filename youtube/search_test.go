@@ -0,0 +1,208 @@
+package youtube
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const searchResultsJSON = `{
+	"kind": "youtube#searchListResponse",
+	"items": [
+		{"id": {"kind": "youtube#channel", "channelId": "chan"}, "snippet": {"title": "A channel"}},
+		{"id": {"kind": "youtube#video", "videoId": "first"}, "snippet": {"title": "Song (Live)", "channelTitle": "Band"}},
+		{"id": {"kind": "youtube#video", "videoId": "second"}, "snippet": {"title": "Song (Official Audio)", "channelTitle": "Band"}}
+	]
+}`
+
+// newSearchServer serves the youtube data api search endpoint, replying with
+// status and body to every request.
+func newSearchServer(t *testing.T, status int, body string) (*httptest.Server, *int) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/search" {
+			t.Errorf("Requested %s instead of /search", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("key") != "k" || query.Get("q") != "song" || query.Get("type") != "video" {
+			t.Errorf("Unexpected search parameters: %s", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	return srv, &requests
+}
+
+func newTestManager(srv *httptest.Server) Manager {
+	return Manager{
+		APIKey:        "k",
+		APIBaseURL:    srv.URL,
+		HTTPClient:    srv.Client(),
+		SearchBackend: SearchBackendAPI,
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv, _ := newSearchServer(t, http.StatusOK, searchResultsJSON)
+	defer srv.Close()
+	results, err := newTestManager(srv).Search("song")
+	if err != nil {
+		t.Fatalf("Search failed: %s", err)
+	}
+	if len(results.Items) != 3 {
+		t.Fatalf("Search returned %d results, want 3", len(results.Items))
+	}
+	if results.Items[1].ID.VideoID != "first" || results.Items[1].Snippet.ChannelTitle != "Band" {
+		t.Errorf("Search result wasn't decoded: %+v", results.Items[1])
+	}
+}
+
+func TestSearchFirstResult(t *testing.T) {
+	srv, _ := newSearchServer(t, http.StatusOK, searchResultsJSON)
+	defer srv.Close()
+	yt := newTestManager(srv)
+	result, err := yt.SearchFirstResult("song")
+	if err != nil {
+		t.Fatalf("SearchFirstResult failed: %s", err)
+	}
+	if result.ID.VideoID != "first" {
+		t.Errorf("SearchFirstResult picked %s, want the first video", result.ID.VideoID)
+	}
+	yt.RankKeywords = []string{"official", "audio"}
+	result, err = yt.SearchFirstResult("song")
+	if err != nil {
+		t.Fatalf("SearchFirstResult failed: %s", err)
+	}
+	if result.ID.VideoID != "second" {
+		t.Errorf("SearchFirstResult picked %s, want the video matching the keywords", result.ID.VideoID)
+	}
+}
+
+func TestSearchNoResults(t *testing.T) {
+	srv, _ := newSearchServer(t, http.StatusOK, `{"kind": "youtube#searchListResponse", "items": []}`)
+	defer srv.Close()
+	yt := newTestManager(srv)
+	results, err := yt.Search("song")
+	if err != nil {
+		t.Fatalf("Search failed: %s", err)
+	}
+	if len(results.Items) != 0 {
+		t.Errorf("Search returned %d results, want none", len(results.Items))
+	}
+	if _, err := yt.SearchFirstResult("song"); err == nil {
+		t.Error("SearchFirstResult didn't fail without any results")
+	}
+}
+
+func TestSearchBadStatus(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError} {
+		srv, _ := newSearchServer(t, status, `{"error": {"code": 500}}`)
+		_, err := newTestManager(srv).Search("song")
+		srv.Close()
+		if err == nil {
+			t.Errorf("Search didn't fail when the api responded with %d", status)
+		}
+	}
+}
+
+func TestSearchQuotaExceeded(t *testing.T) {
+	srv, _ := newSearchServer(t, http.StatusForbidden, `{"error": {"errors": [{"reason": "quotaExceeded"}]}}`)
+	defer srv.Close()
+	yt := newTestManager(srv)
+	if _, err := yt.apiSearch("song"); err != ErrQuotaExceeded {
+		t.Errorf("apiSearch returned %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestSearchMalformedJSON(t *testing.T) {
+	srv, _ := newSearchServer(t, http.StatusOK, `{"items": [`)
+	defer srv.Close()
+	if _, err := newTestManager(srv).Search("song"); err == nil {
+		t.Error("Search didn't fail on malformed json")
+	}
+}
+
+func TestSearchCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piccolo-search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv, requests := newSearchServer(t, http.StatusOK, searchResultsJSON)
+	defer srv.Close()
+	yt := newTestManager(srv)
+	yt.SearchCache = NewSearchCache(filepath.ToSlash(filepath.Join(dir, "search_cache.json")), time.Hour)
+	for i := 0; i < 2; i++ {
+		results, err := yt.Search("song")
+		if err != nil {
+			t.Fatalf("Search failed: %s", err)
+		}
+		if len(results.Items) != 3 {
+			t.Fatalf("Search returned %d results, want 3", len(results.Items))
+		}
+	}
+	if *requests != 1 {
+		t.Errorf("The api was searched %d times, want the second search to be cached", *requests)
+	}
+}
+
+func TestSearchCacheKey(t *testing.T) {
+	yt := Manager{}
+	if yt.searchCacheKey(SearchBackendAPI, "Some  Song") != yt.searchCacheKey(SearchBackendAPI, "some song") {
+		t.Error("Searches differing by case and spacing have different keys")
+	}
+	filtered := []Manager{{SafeSearch: "strict"}, {RegionCode: "GB"}, {VideoCategoryID: "10"}}
+	for _, filteredYt := range filtered {
+		if filteredYt.searchCacheKey(SearchBackendAPI, "song") == yt.searchCacheKey(SearchBackendAPI, "song") {
+			t.Errorf("Search with filters %+v shares a key with an unfiltered search", filteredYt)
+		}
+	}
+}
+
+func TestYtDlSearchDuration(t *testing.T) {
+	binary, dir := fakeYtDl(t, `echo '{"id":"a","title":"Song A","channel":"Band","duration":185.0}'
+echo '{"id":"b","title":"Song B","uploader":"Band"}'
+`)
+	defer os.RemoveAll(dir)
+	results, err := Manager{YtDlPath: binary, SearchBackend: SearchBackendYtDl}.Search("song")
+	if err != nil {
+		t.Fatalf("Search failed: %s", err)
+	}
+	if len(results.Items) != 2 {
+		t.Fatalf("Search returned %d results, want 2", len(results.Items))
+	}
+	if results.Items[0].Duration != 185*time.Second {
+		t.Errorf("Duration = %s, want 3m5s", results.Items[0].Duration)
+	}
+	if results.Items[1].Duration != 0 || results.Items[1].Snippet.ChannelTitle != "Band" {
+		t.Errorf("Second result = %+v", results.Items[1])
+	}
+}
+
+func TestInvidiousSearchDuration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/search" {
+			t.Errorf("Requested %s instead of /api/v1/search", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"type": "channel", "author": "Band"},
+			{"type": "video", "videoId": "a", "title": "Song A", "author": "Band", "lengthSeconds": 185}
+		]`))
+	}))
+	defer srv.Close()
+	yt := Manager{InvidiousURL: srv.URL, HTTPClient: srv.Client(), SearchBackend: SearchBackendInvidious}
+	results, err := yt.Search("song")
+	if err != nil {
+		t.Fatalf("Search failed: %s", err)
+	}
+	if len(results.Items) != 1 || results.Items[0].Duration != 185*time.Second {
+		t.Errorf("Search returned %+v, want one video lasting 3m5s", results.Items)
+	}
+}
@@ -0,0 +1,193 @@
+package youtube
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jatgam/goutils/log"
+)
+
+const (
+	// SearchBackendAPI searches with the youtube data api.
+	SearchBackendAPI = "api"
+	// SearchBackendYtDl searches with the youtube-dl or yt-dlp binary.
+	SearchBackendYtDl = "ytdl"
+	// SearchBackendInvidious searches with an invidious instance.
+	SearchBackendInvidious = "invidious"
+
+	searchResultKind  = "youtube#searchResult"
+	videoKind         = "youtube#video"
+	keylessMaxResults = searchMaxResults
+)
+
+type (
+	ytDlSearchResult struct {
+		ID           string  `json:"id"`
+		Title        string  `json:"title"`
+		Description  string  `json:"description"`
+		ChannelID    string  `json:"channel_id"`
+		Channel      string  `json:"channel"`
+		Uploader     string  `json:"uploader"`
+		LiveStatus   string  `json:"live_status"`
+		IsLive       bool    `json:"is_live"`
+		UploadDate   string  `json:"upload_date"`
+		ThumbnailURL string  `json:"thumbnail"`
+		Duration     float64 `json:"duration"`
+	}
+
+	invidiousSearchResult struct {
+		Type            string `json:"type"`
+		Title           string `json:"title"`
+		VideoID         string `json:"videoId"`
+		Author          string `json:"author"`
+		AuthorID        string `json:"authorId"`
+		Description     string `json:"description"`
+		LiveNow         bool   `json:"liveNow"`
+		LengthSeconds   int    `json:"lengthSeconds"`
+		VideoThumbnails []struct {
+			Quality string  `json:"quality"`
+			URL     string  `json:"url"`
+			Width   float64 `json:"width"`
+			Height  float64 `json:"height"`
+		} `json:"videoThumbnails"`
+	}
+)
+
+func (yt Manager) searchBackend() string {
+	if yt.SearchBackend != "" {
+		return yt.SearchBackend
+	}
+	if yt.APIKey != "" {
+		return SearchBackendAPI
+	}
+	return SearchBackendYtDl
+}
+
+func liveBroadcastContent(live bool) string {
+	if live {
+		return "live"
+	}
+	return "none"
+}
+
+// ytDlSearch searches using the search feature of the youtube-dl binary, no
+// api key is needed.
+func (yt Manager) ytDlSearch(searchStr string) (SearchListResponse, error) {
+	var searchResponse SearchListResponse
+	binary := yt.YtDlPath
+	if binary == "" {
+		binary = defaultYtDlBinary
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, "--dump-json", "--flat-playlist", "--no-warnings",
+		"ytsearch"+strconv.Itoa(keylessMaxResults)+":"+searchStr)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("[WARN] Error searching: %s", err)
+		return searchResponse, fmt.Errorf("%s search failed: %s: %s", binary, err, strings.TrimSpace(stderr.String()))
+	}
+	// Each result is printed as json on its own line
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var result ytDlSearchResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			return searchResponse, fmt.Errorf("Couldn't decode %s search result: %s", binary, err)
+		}
+		if result.ID == "" {
+			continue
+		}
+		item := SearchResult{Kind: searchResultKind}
+		item.ID.Kind = videoKind
+		item.ID.VideoID = result.ID
+		item.Snippet.Title = result.Title
+		item.Snippet.Description = result.Description
+		item.Snippet.ChannelID = result.ChannelID
+		item.Snippet.ChannelTitle = result.Channel
+		if item.Snippet.ChannelTitle == "" {
+			item.Snippet.ChannelTitle = result.Uploader
+		}
+		item.Snippet.Thumbnails.Default.URL = result.ThumbnailURL
+		item.Duration = time.Duration(result.Duration * float64(time.Second))
+		item.Snippet.LiveBroadcastContent = liveBroadcastContent(result.IsLive || result.LiveStatus == "is_live")
+		searchResponse.Items = append(searchResponse.Items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return searchResponse, err
+	}
+	return searchResponse, nil
+}
+
+// invidiousSearch searches using the api of an invidious instance, no api key
+// is needed.
+func (yt Manager) invidiousSearch(searchStr string) (SearchListResponse, error) {
+	var searchResponse SearchListResponse
+	if yt.InvidiousURL == "" {
+		return searchResponse, fmt.Errorf("No invidious url configured")
+	}
+	searchURL, err := url.Parse(strings.TrimSuffix(yt.InvidiousURL, "/") + "/api/v1/search")
+	if err != nil {
+		return searchResponse, err
+	}
+	searchParameters := url.Values{}
+	searchParameters.Add("q", searchStr)
+	searchParameters.Add("type", "video")
+	if yt.RegionCode != "" {
+		searchParameters.Add("region", yt.RegionCode)
+	}
+	searchURL.RawQuery = searchParameters.Encode()
+
+	resp, err := yt.httpClient().Get(searchURL.String())
+	if err != nil {
+		log.Printf("[WARN] Error searching: %s", err)
+		return searchResponse, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		log.Printf("[WARN] Search failed with status: %s", resp.Status)
+		return searchResponse, fmt.Errorf("Got a bad http response: %s", resp.Status)
+	}
+	var results []invidiousSearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return searchResponse, fmt.Errorf("Couldn't decode invidious search results: %s", err)
+	}
+	for _, result := range results {
+		if result.Type != "video" || result.VideoID == "" {
+			continue
+		}
+		item := SearchResult{Kind: searchResultKind}
+		item.ID.Kind = videoKind
+		item.ID.VideoID = result.VideoID
+		item.Snippet.Title = result.Title
+		item.Snippet.Description = result.Description
+		item.Snippet.ChannelID = result.AuthorID
+		item.Snippet.ChannelTitle = result.Author
+		for _, thumbnail := range result.VideoThumbnails {
+			info := thumbnailInfo{URL: thumbnail.URL, Width: thumbnail.Width, Height: thumbnail.Height}
+			switch thumbnail.Quality {
+			case "default":
+				item.Snippet.Thumbnails.Default = info
+			case "medium":
+				item.Snippet.Thumbnails.Medium = info
+			case "high":
+				item.Snippet.Thumbnails.High = info
+			}
+		}
+		item.Snippet.LiveBroadcastContent = liveBroadcastContent(result.LiveNow)
+		item.Duration = time.Duration(result.LengthSeconds) * time.Second
+		searchResponse.Items = append(searchResponse.Items, item)
+	}
+	return searchResponse, nil
+}
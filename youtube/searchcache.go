@@ -0,0 +1,137 @@
+package youtube
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jatgam/goutils/log"
+)
+
+type (
+	// CachedSearch is the results of a search and when it was made
+	CachedSearch struct {
+		Results  SearchListResponse `json:"results"`
+		CachedAt time.Time          `json:"cachedAt"`
+	}
+
+	// SearchCacheJSON is used to handle marshalling and unmarshalling cached
+	// searches to a file on disk
+	SearchCacheJSON struct {
+		Searches map[string]CachedSearch `json:"searches"`
+	}
+
+	// SearchCache remembers search results, so repeated searches don't use up
+	// the api quota. A nil cache caches nothing.
+	SearchCache struct {
+		cachePath string
+		ttl       time.Duration
+		searches  map[string]CachedSearch
+		lock      *sync.Mutex
+	}
+)
+
+// NewSearchCache creates a search cache stored at cachePath, where results are
+// kept for ttl.
+func NewSearchCache(cachePath string, ttl time.Duration) *SearchCache {
+	c := &SearchCache{cachePath: cachePath, ttl: ttl, searches: make(map[string]CachedSearch), lock: &sync.Mutex{}}
+	c.loadSearches()
+	return c
+}
+
+// searchCacheKey normalizes a search, so searches that only differ by case or
+// spacing share results. The search filters are part of the key, so changing
+// them doesn't return results found with the old filters.
+func (yt Manager) searchCacheKey(backend string, searchStr string) string {
+	return strings.Join([]string{backend, yt.SafeSearch, yt.RegionCode, yt.VideoCategoryID,
+		strings.Join(strings.Fields(strings.ToLower(searchStr)), " ")}, ":")
+}
+
+func (c *SearchCache) loadSearches() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cacheFileContents, err := ioutil.ReadFile(filepath.FromSlash(c.cachePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(c.cachePath),
+			"error": err,
+		}).Error("Failed to open search cache file to read")
+		return fmt.Errorf("Couldn't read the search cache file")
+	}
+	var fileSearches = SearchCacheJSON{}
+	jsonErr := json.Unmarshal(cacheFileContents, &fileSearches)
+	if jsonErr != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(c.cachePath),
+			"error": jsonErr,
+		}).Error("Failed to decode search cache json")
+		return fmt.Errorf("Couldn't decode the search cache file")
+	}
+	for key, search := range fileSearches.Searches {
+		if time.Since(search.CachedAt) < c.ttl {
+			c.searches[key] = search
+		}
+	}
+	log.Debug("Loaded search cache")
+	return nil
+}
+
+// saveSearches must be called with the search cache lock held.
+func (c *SearchCache) saveSearches() error {
+	cacheDir := filepath.FromSlash(path.Dir(c.cachePath))
+	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
+		err := os.MkdirAll(cacheDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	jsonSearches, _ := json.MarshalIndent(&SearchCacheJSON{Searches: c.searches}, "", "    ")
+	err := ioutil.WriteFile(filepath.FromSlash(c.cachePath), jsonSearches, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  filepath.FromSlash(c.cachePath),
+			"error": err,
+		}).Error("Failed to write search cache json file")
+		return fmt.Errorf("Error saving search cache file")
+	}
+	return nil
+}
+
+// get returns the cached results of a search, if they haven't expired.
+func (c *SearchCache) get(key string) (SearchListResponse, bool) {
+	if c == nil || c.ttl <= 0 {
+		return SearchListResponse{}, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	search, ok := c.searches[key]
+	if !ok || time.Since(search.CachedAt) >= c.ttl {
+		return SearchListResponse{}, false
+	}
+	return search.Results, true
+}
+
+// put caches the results of a search, dropping any expired searches.
+func (c *SearchCache) put(key string, results SearchListResponse) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for cachedKey, search := range c.searches {
+		if time.Since(search.CachedAt) >= c.ttl {
+			delete(c.searches, cachedKey)
+		}
+	}
+	c.searches[key] = CachedSearch{Results: results, CachedAt: time.Now()}
+	c.saveSearches()
+}
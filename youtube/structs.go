@@ -1,11 +1,46 @@
 package youtube
 
+import (
+	"net/http"
+	"time"
+)
+
 type (
 	// Manager is used to initialize a youtube object with needed config.
 	Manager struct {
 		APIKey     string
 		YtDlPath   string
 		YTCacheDir string
+		// Extractors are the names of the extractors to try, in order
+		Extractors []string
+		// SearchBackend is the name of the search backend to use, if empty the
+		// api is used when there is an api key, otherwise ytdl.
+		SearchBackend string
+		// InvidiousURL is the base url of the invidious instance used by the
+		// invidious search backend
+		InvidiousURL string
+		// SearchCache remembers search results, nil to disable caching
+		SearchCache *SearchCache
+		// Quota tracks the youtube data api quota used, nil to disable
+		// tracking
+		Quota *QuotaTracker
+		// HTTPClient makes every http request, http.DefaultClient is used if
+		// nil
+		HTTPClient *http.Client
+		// APIBaseURL is the youtube data api url, the default is used if empty
+		APIBaseURL string
+		// SafeSearch is none, moderate or strict, youtube's default is used if
+		// empty
+		SafeSearch string
+		// RegionCode is the ISO 3166-1 alpha-2 country code results should be
+		// available in
+		RegionCode string
+		// VideoCategoryID limits searches to a video category, such as 10 for
+		// music
+		VideoCategoryID string
+		// RankKeywords are words in a video title that make it preferred when
+		// picking a search result
+		RankKeywords []string
 	}
 
 	thumbnailInfo struct {
@@ -37,6 +72,9 @@ type (
 			ChannelTitle         string `json:"channelTitle"`
 			LiveBroadcastContent string `json:"liveBroadcastContent"`
 		} `json:"snippet"`
+		// Duration is the length of the video, when the search backend
+		// includes it. The api doesn't, so it is 0 for api searches.
+		Duration time.Duration `json:"duration,omitempty"`
 	}
 
 	// SearchListResponse is used for json unmarshalling a Youtube search
@@ -54,6 +92,41 @@ type (
 		Items []SearchResult `json:"items"`
 	}
 
+	// VideoResult is used for json unmarshalling a Youtube video resource.
+	VideoResult struct {
+		Kind    string `json:"kind"`
+		Etag    string `json:"etag"`
+		ID      string `json:"id"`
+		Snippet struct {
+			Title        string `json:"title"`
+			ChannelTitle string `json:"channelTitle"`
+			Thumbnails   struct {
+				Default thumbnailInfo `json:"default"`
+				Medium  thumbnailInfo `json:"medium"`
+				High    thumbnailInfo `json:"high"`
+			} `json:"thumbnails"`
+		} `json:"snippet"`
+		ContentDetails struct {
+			Duration string `json:"duration"`
+		} `json:"contentDetails"`
+	}
+
+	// VideoDetails is information about a video that isn't included in search
+	// results.
+	VideoDetails struct {
+		Duration     time.Duration
+		ChannelTitle string
+		ThumbnailURL string
+	}
+
+	// VideoListResponse is used for json unmarshalling a Youtube videos list
+	// result
+	VideoListResponse struct {
+		Kind  string        `json:"kind"`
+		Etag  string        `json:"etag"`
+		Items []VideoResult `json:"items"`
+	}
+
 	// VideoFormatInfo map[string]string
 	// YoutubeVideo    struct {
 	// 	ID      string
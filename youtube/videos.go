@@ -0,0 +1,246 @@
+package youtube
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jatgam/goutils"
+	"github.com/jatgam/goutils/log"
+)
+
+// maxVideosPerRequest is the most videos the api can look up at once.
+const maxVideosPerRequest = 50
+
+var isoDurationRegex = regexp.MustCompile(`^P(?:(?P<days>\d+)D)?(?:T(?:(?P<hours>\d+)H)?(?:(?P<minutes>\d+)M)?(?:(?P<seconds>\d+)S)?)?$`)
+
+// titleBracketsRegex matches the bracketed parts of a title, such as
+// (Official Video) or [Lyrics].
+var titleBracketsRegex = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+
+// titleNoiseWords describe an upload rather than the song, so they are ignored
+// when comparing titles.
+var titleNoiseWords = map[string]bool{
+	"official": true, "video": true, "audio": true, "music": true, "lyrics": true, "lyric": true,
+	"hd": true, "hq": true, "4k": true, "remastered": true, "live": true, "cover": true,
+	"ft": true, "feat": true, "version": true,
+}
+
+func (yt Manager) createVideosURL(videoIDs []string) (*string, error) {
+	videosURL, err := url.Parse(yt.apiURL("videos"))
+	if err != nil {
+		return nil, err
+	}
+	videosParameters := url.Values{}
+	videosParameters.Add("part", "contentDetails,snippet")
+	videosParameters.Add("id", strings.Join(videoIDs, ","))
+	videosParameters.Add("key", yt.APIKey)
+
+	videosURL.RawQuery = videosParameters.Encode()
+	videosStr := videosURL.String()
+	return &videosStr, nil
+}
+
+type invidiousVideo struct {
+	RecommendedVideos []struct {
+		VideoID  string `json:"videoId"`
+		Title    string `json:"title"`
+		Author   string `json:"author"`
+		AuthorID string `json:"authorId"`
+		LiveNow  bool   `json:"liveNow"`
+	} `json:"recommendedVideos"`
+}
+
+// RelatedVideos finds videos similar to a youtube video. The data api no longer
+// supports finding related videos, so an invidious instance's recommendations
+// are used when one is configured, otherwise the configured search backend is
+// searched for the video's title. A search mostly finds other uploads of the
+// same song, such as lyric videos and covers, so those are left out. The video
+// itself may be in the results.
+func (yt Manager) RelatedVideos(videoID string, title string) (SearchListResponse, error) {
+	if yt.InvidiousURL != "" {
+		related, err := yt.invidiousRelated(videoID)
+		if err == nil {
+			return related, nil
+		}
+		log.Printf("[WARN] Error finding recommended videos, searching instead: %s", err)
+	}
+	if title == "" {
+		return SearchListResponse{}, fmt.Errorf("No title to find videos related to %s", videoID)
+	}
+	results, err := yt.Search(title)
+	if err != nil {
+		return results, err
+	}
+	// The search results may be cached, so they are copied rather than
+	// filtered in place
+	related := results
+	related.Items = nil
+	for _, item := range results.Items {
+		if !sameSong(title, item.Snippet.Title) {
+			related.Items = append(related.Items, item)
+		}
+	}
+	return related, nil
+}
+
+// titleWords splits a title into the words that name the song, leaving out
+// anything in brackets, punctuation and words describing the upload.
+func titleWords(title string) []string {
+	title = titleBracketsRegex.ReplaceAllString(strings.ToLower(title), " ")
+	var words []string
+	for _, word := range strings.FieldsFunc(title, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) {
+		if !titleNoiseWords[word] {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// sameSong checks if title is probably another upload of the song named by
+// seedTitle, because it has every word of the seed title in it.
+func sameSong(seedTitle string, title string) bool {
+	seedWords := titleWords(seedTitle)
+	if len(seedWords) == 0 {
+		return false
+	}
+	words := make(map[string]bool)
+	for _, word := range titleWords(title) {
+		words[word] = true
+	}
+	for _, word := range seedWords {
+		if !words[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// invidiousRelated returns the videos an invidious instance recommends after a
+// video.
+func (yt Manager) invidiousRelated(videoID string) (SearchListResponse, error) {
+	var relatedResponse SearchListResponse
+	videoURL, err := url.Parse(strings.TrimSuffix(yt.InvidiousURL, "/") + "/api/v1/videos/" + url.PathEscape(videoID))
+	if err != nil {
+		return relatedResponse, err
+	}
+	videoURL.RawQuery = url.Values{"fields": {"recommendedVideos"}}.Encode()
+	resp, err := yt.httpClient().Get(videoURL.String())
+	if err != nil {
+		return relatedResponse, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return relatedResponse, fmt.Errorf("Got a bad http response: %s", resp.Status)
+	}
+	var video invidiousVideo
+	if err := json.NewDecoder(resp.Body).Decode(&video); err != nil {
+		return relatedResponse, fmt.Errorf("Couldn't decode invidious video: %s", err)
+	}
+	for _, recommended := range video.RecommendedVideos {
+		if recommended.VideoID == "" {
+			continue
+		}
+		item := SearchResult{Kind: searchResultKind}
+		item.ID.Kind = videoKind
+		item.ID.VideoID = recommended.VideoID
+		item.Snippet.Title = recommended.Title
+		item.Snippet.ChannelID = recommended.AuthorID
+		item.Snippet.ChannelTitle = recommended.Author
+		item.Snippet.LiveBroadcastContent = liveBroadcastContent(recommended.LiveNow)
+		relatedResponse.Items = append(relatedResponse.Items, item)
+	}
+	return relatedResponse, nil
+}
+
+// VideoDetails takes a list of youtube video ids and looks up the duration,
+// channel and thumbnail of each video. The returned map is keyed by video id,
+// any video that couldn't be found is left out.
+func (yt Manager) VideoDetails(videoIDs []string) (map[string]VideoDetails, error) {
+	details := make(map[string]VideoDetails)
+	if len(videoIDs) > 0 && yt.APIKey == "" {
+		return details, fmt.Errorf("An api key is needed to look up video details")
+	}
+	for start := 0; start < len(videoIDs); start += maxVideosPerRequest {
+		end := start + maxVideosPerRequest
+		if end > len(videoIDs) {
+			end = len(videoIDs)
+		}
+		err := yt.lookupVideoDetails(videoIDs[start:end], details)
+		if err != nil {
+			return details, err
+		}
+	}
+	return details, nil
+}
+
+// lookupVideoDetails looks up at most maxVideosPerRequest videos, adding them
+// to details.
+func (yt Manager) lookupVideoDetails(videoIDs []string, details map[string]VideoDetails) error {
+	videosURL, err := yt.createVideosURL(videoIDs)
+	if err != nil {
+		return err
+	}
+	resp, err := yt.apiGet(*videosURL, videosQuotaCost)
+	if err != nil {
+		log.Printf("[WARN] Error looking up videos: %s", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		log.Printf("[WARN] Video lookup failed with status: %s", resp.Status)
+		return fmt.Errorf("Got a bad http response: %s", resp.Status)
+	}
+	var videosResponse VideoListResponse
+	err = json.NewDecoder(resp.Body).Decode(&videosResponse)
+	if err != nil {
+		return err
+	}
+	for _, video := range videosResponse.Items {
+		duration, err := ParseDuration(video.ContentDetails.Duration)
+		if err != nil {
+			continue
+		}
+		thumbnailURL := video.Snippet.Thumbnails.High.URL
+		if thumbnailURL == "" {
+			thumbnailURL = video.Snippet.Thumbnails.Default.URL
+		}
+		details[video.ID] = VideoDetails{
+			Duration:     duration,
+			ChannelTitle: video.Snippet.ChannelTitle,
+			ThumbnailURL: thumbnailURL,
+		}
+	}
+	return nil
+}
+
+// ParseDuration converts an ISO 8601 duration, as used by the youtube api
+// (e.g. PT1H2M3S), to a time.Duration.
+func ParseDuration(isoDuration string) (time.Duration, error) {
+	if !isoDurationRegex.MatchString(isoDuration) {
+		return 0, fmt.Errorf("Invalid duration: %s", isoDuration)
+	}
+	var duration time.Duration
+	units := map[string]time.Duration{
+		"days":    24 * time.Hour,
+		"hours":   time.Hour,
+		"minutes": time.Minute,
+		"seconds": time.Second,
+	}
+	for name, value := range goutils.REGetNamedGroupsResults(isoDurationRegex, isoDuration) {
+		if value == "" {
+			continue
+		}
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, err
+		}
+		duration += time.Duration(num) * units[name]
+	}
+	return duration, nil
+}
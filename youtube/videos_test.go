@@ -0,0 +1,80 @@
+package youtube
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSameSong(t *testing.T) {
+	seed := "Band - Song Title (Official Video)"
+	tests := []struct {
+		title string
+		same  bool
+	}{
+		{"Band - Song Title (Official Video)", true},
+		{"BAND - SONG TITLE [Lyrics]", true},
+		{"Band - Song Title (Official Audio) HD", true},
+		{"Song Title - Band cover by Someone", true},
+		{"Band - Song Title live at the Stadium", true},
+		{"Band - Another Song (Official Video)", false},
+		{"Other Band - Song", false},
+	}
+	for _, test := range tests {
+		if got := sameSong(seed, test.title); got != test.same {
+			t.Errorf("sameSong(%q, %q) = %t, want %t", seed, test.title, got, test.same)
+		}
+	}
+	if sameSong("(Official Video)", "Anything") {
+		t.Error("A title with no song words matched")
+	}
+}
+
+func TestRelatedVideosSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items": [
+			{"id": {"videoId": "seed"}, "snippet": {"title": "Band - Song Title (Official Video)"}},
+			{"id": {"videoId": "lyrics"}, "snippet": {"title": "Band - Song Title [Lyrics]"}},
+			{"id": {"videoId": "other"}, "snippet": {"title": "Band - Different Tune"}}
+		]}`))
+	}))
+	defer srv.Close()
+	yt := Manager{APIKey: "k", APIBaseURL: srv.URL, HTTPClient: srv.Client(), SearchBackend: SearchBackendAPI}
+	related, err := yt.RelatedVideos("seed", "Band - Song Title (Official Video)")
+	if err != nil {
+		t.Fatalf("RelatedVideos failed: %s", err)
+	}
+	if len(related.Items) != 1 || related.Items[0].ID.VideoID != "other" {
+		t.Errorf("RelatedVideos returned %+v, want only the other song", related.Items)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		iso      string
+		duration time.Duration
+	}{
+		{"PT3M5S", 3*time.Minute + 5*time.Second},
+		{"PT1H2M3S", time.Hour + 2*time.Minute + 3*time.Second},
+		{"PT45S", 45 * time.Second},
+		{"PT10M", 10 * time.Minute},
+		{"PT2H", 2 * time.Hour},
+		{"P1DT1S", 24*time.Hour + time.Second},
+		{"P0D", 0},
+	}
+	for _, test := range tests {
+		duration, err := ParseDuration(test.iso)
+		if err != nil {
+			t.Errorf("ParseDuration(%s) failed: %s", test.iso, err)
+		} else if duration != test.duration {
+			t.Errorf("ParseDuration(%s) = %s, want %s", test.iso, duration, test.duration)
+		}
+	}
+	for _, invalid := range []string{"", "3:05", "PT1.5S", "T1M", "PT1S2M"} {
+		if _, err := ParseDuration(invalid); err == nil {
+			t.Errorf("ParseDuration(%q) didn't fail", invalid)
+		}
+	}
+}